@@ -8,6 +8,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"time"
 )
 
 var ErrTooShort = errors.New("bson document too short")
@@ -21,8 +22,21 @@ var ErrTooShort = errors.New("bson document too short")
 //
 // Map values encode as JSON objects. The map's key type must be string;
 // the object keys are used directly as map keys.
+//
+// Signed integers of 32 bits or fewer, uint8 and uint16 encode as BSON
+// int32. int encodes as int32 when its value fits, and int64 otherwise.
+// int64, uint32, uint and uint64 encode as BSON int64; an unsigned value
+// larger than math.MaxInt64 is an error. float32 and float64 encode as
+// BSON double.
+//
+// time.Time values encode as BSON UTC datetimes, truncated to the
+// millisecond; see NewDatetime.
 func Marshal(v interface{}) ([]byte, error) {
-	return encode(v)
+	var w writer
+	if err := encode(&w, v); err != nil {
+		return nil, err
+	}
+	return w.bson, nil
 }
 
 // Unmarshal parses the BSON-encoded data and stores the result in the
@@ -79,7 +93,8 @@ func (d *Decoder) Decode(v interface{}) error {
 
 // An Encoder writes BSON objects to an output stream.
 type Encoder struct {
-	w io.Writer
+	w          io.Writer
+	forceInt64 bool
 }
 
 // NewEncoder returns a new encoder that writes to w.
@@ -93,19 +108,90 @@ func NewEncoder(w io.Writer) *Encoder {
 // See the documentation for Marshal for details about the conversion of Go
 // values to BSON.
 func (e *Encoder) Encode(v interface{}) error {
-	buf, err := Marshal(v)
-	if err != nil {
+	w := writer{forceInt64: e.forceInt64}
+	if err := encode(&w, v); err != nil {
 		return err
 	}
-	_, err = e.w.Write(buf)
+	_, err := e.w.Write(w.bson)
 	return err
 }
 
-// ObjectId represnts a BSON ObjectId data type
+// SetForceInt64 specifies whether Go integers should always be encoded
+// as BSON int64, rather than as int32 when their type permits. The
+// default is false.
+func (e *Encoder) SetForceInt64(on bool) {
+	e.forceInt64 = on
+}
+
+// ObjectId represents a BSON ObjectId: a 4-byte big-endian creation time
+// in seconds since the Unix epoch, a 5-byte value random to the creating
+// process, and a 3-byte big-endian counter. See NewObjectId.
 type ObjectId [12]byte
 
-// Datetime because dates
-type Datetime uint64
+// D represents a BSON document as an ordered list of elements. Marshal
+// writes the elements of a D in order, and Unmarshal into a D preserves
+// the order of the document, decoding any embedded documents as D.
+//
+//	bson.D{{"find", "users"}, {"filter", bson.D{{"name", "dave"}}}}
+type D []E
+
+// E is a single element of a D.
+type E struct {
+	Key   string
+	Value interface{}
+}
+
+// Binary represents a BSON binary data element. Data of the generic
+// subtype 0x00 is decoded into interface{} values as a []byte, which
+// encodes as a Binary of that subtype.
+type Binary struct {
+	Subtype byte
+	Data    []byte
+}
+
+// JavaScript represents a BSON JavaScript code element.
+type JavaScript string
 
-// Timestamp because timestamp
-type Timestamp uint64
+// CodeWithScope represents a BSON JavaScript code with scope element.
+// Scope may hold any value that Marshal encodes as a document; it is
+// decoded as a map[string]interface{}.
+type CodeWithScope struct {
+	Code  string
+	Scope interface{}
+}
+
+// Symbol represents the deprecated BSON symbol element.
+type Symbol string
+
+// DBPointer represents the deprecated BSON DBPointer element, a reference
+// to the document with _id ID in the collection named by Ref.
+type DBPointer struct {
+	Ref string
+	ID  ObjectId
+}
+
+// MinKey represents the BSON min key, which compares lower than all
+// other values.
+type MinKey struct{}
+
+// MaxKey represents the BSON max key, which compares higher than all
+// other values.
+type MaxKey struct{}
+
+// Undefined represents the deprecated BSON undefined value.
+type Undefined struct{}
+
+// Datetime represents a BSON UTC datetime, the number of milliseconds
+// since the Unix epoch. Negative values represent times before 1970.
+type Datetime int64
+
+// NewDatetime returns the Datetime for t. Any part of t finer than a
+// millisecond is truncated towards the past.
+func NewDatetime(t time.Time) Datetime {
+	return Datetime(t.Unix()*1e3 + int64(t.Nanosecond())/1e6)
+}
+
+// Time returns d as a time.Time in UTC.
+func (d Datetime) Time() time.Time {
+	return time.Unix(int64(d)/1e3, int64(d)%1e3*1e6).UTC()
+}
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"math"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var marshalTests = []struct {
@@ -20,8 +22,24 @@ var marshalTests = []struct {
 }, {
 	v:        M{"int64": int64(1)},
 	expected: []byte{0x14, 0x00, 0x00, 0x00, 0x12, 0x69, 0x6e, 0x74, 0x36, 0x34, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+}, {
+	v:        taggedStruct{Int: 1, Skip: 7},
+	expected: []byte("\x0e\x00\x00\x00\x10int\x00\x01\x00\x00\x00\x00"),
+}, {
+	v:        &taggedStruct{Int: 1, Name: "bob"},
+	expected: []byte("\x1c\x00\x00\x00\x10int\x00\x01\x00\x00\x00\x02Name\x00\x04\x00\x00\x00bob\x00\x00"),
+}, {
+	v:        struct{ B, A int32 }{B: 2, A: 1},
+	expected: []byte("\x13\x00\x00\x00\x10B\x00\x02\x00\x00\x00\x10A\x00\x01\x00\x00\x00\x00"),
 }}
 
+type taggedStruct struct {
+	Int    int32  `bson:"int"`
+	Name   string `bson:",omitempty"`
+	Skip   int64  `bson:"-"`
+	hidden int32
+}
+
 func TestMarshal(t *testing.T) {
 	for _, tt := range marshalTests {
 		got, err := Marshal(tt.v)
@@ -71,7 +89,7 @@ func TestNewDecoder(t *testing.T) {
 	switch d.(type) {
 	case *Decoder:
 	default:
-		t.Fatal("NewDecoder extended %T, got %T", new(Decoder), d)
+		t.Fatalf("NewDecoder: expected %T, got %T", new(Decoder), d)
 	}
 	if d == nil {
 		t.Fatal("NewDecoder returned nil *Decoder")
@@ -85,7 +103,7 @@ func TestNewEncoder(t *testing.T) {
 	switch e.(type) {
 	case *Encoder:
 	default:
-		t.Fatal("NewEncoder extended %T, got %T", new(Encoder), e)
+		t.Fatalf("NewEncoder: expected %T, got %T", new(Encoder), e)
 	}
 	if e == nil {
 		t.Fatal("NewEncoder returned nil *Encoder")
@@ -128,18 +146,18 @@ var libbsonTests = []string{
 	"test1.bson",
 	"test2.bson",
 	// "test3.bson", // double
-	// "test4.bson", // timestamp
+	"test4.bson", // datetime
 	"test5.bson",
 	"test6.bson",
 	// "test7.bson", // []double
 	"test8.bson",
-	"test9.bson", // null
-	// "test10.bson", // regex
+	"test9.bson",  // null
+	"test10.bson", // regex
 	"test11.bson",
 	//"test12.bson", // bson is awesome
 	"test13.bson", // array[bool]
 	"test14.bson", // array[string]
-	// "test15.bson", // array[datetime]
+	"test15.bson", // array[datetime]
 	"test16.bson",
 	// "test17.bson", // objectid
 	"test18.bson", // map[nil]
@@ -147,18 +165,19 @@ var libbsonTests = []string{
 	// "test20.bson",
 	"test21.bson",
 	"test23.bson",
-	// "test24.bson", // binary data
-	//"test25.bson", "test32.bson" // deprecated
-	// "test26.bson", // datatime
-	// "test27.bson", // regex
-	// "test28.bson", // db pointer
-	// "test29.bson", "test30.bson", // javascript
-	// "test31.bson", // javascript w/scope
+	"test24.bson",                // binary data
+	"test25.bson",                // undefined
+	"test32.bson",                // symbol
+	"test26.bson",                // datetime
+	"test27.bson",                // regex
+	"test28.bson",                // db pointer
+	"test29.bson", "test30.bson", // javascript
+	"test31.bson", // javascript w/scope
 	// "test33.bson",
 	// "test34.bson", // one byte short ...
 	// "test35.bson", // timestamp
-	// "test36.bson", // MinKey
-	// "test37.bson", // MaxKey
+	"test36.bson", // MinKey
+	"test37.bson", // MaxKey
 	"test38.bson",
 	"test39.bson",
 	"dollarquery.bson",
@@ -167,6 +186,8 @@ var libbsonTests = []string{
 	// "stackoverflow.bson",
 	"test56.bson",
 	"readergrow.bson",
+	"binary_deprecated.bson",
+	"codewscope.bson",
 }
 
 // round trip the data in testdata/ taken from the libbson tests.
@@ -201,18 +222,19 @@ var errTests = []struct {
 	err error
 }{
 	// "test40.bson", // panic
-	{"test41.bson", errors.New("corrupt BSON reading utf8 string")},
-	//{"test42.bson", errors.New("corrupt BSON reading utf8 string") },
+	{"test41.bson", &SyntaxError{msg: "corrupt BSON reading utf8 string", Offset: 4}},
+	{"test42.bson", &SyntaxError{msg: "corrupt BSON reading utf8 string", Offset: 4}},
 	{"overflow1.bson", io.ErrUnexpectedEOF},
-	{"overflow2.bson", errors.New("corrupt document: want f bytes, have e")},
-	{"overflow3.bson", errors.New("corrupt document: want c bytes, have b")},
-	{"overflow4.bson", errors.New("corrupt BSON reading utf8 string")},
-
-	//{"test43.bson", errors.New("corrupt BSON reading utf8 string") },
-	//{"test44.bson", errors.New("corrupt BSON reading utf8 string") },
-	//{"test45.bson", errors.New("corrupt BSON reading utf8 string") },
-	// {"test57.bson", errors.New("corrupt BSON reading utf8 string") },
+	{"overflow2.bson", &SyntaxError{msg: "corrupt document: want f bytes, have e", Offset: 4, Path: "foo"}},
+	{"overflow3.bson", &SyntaxError{msg: "corrupt document: want c bytes, have b", Offset: 4, Path: "foo"}},
+	{"overflow4.bson", &SyntaxError{msg: "corrupt BSON reading utf8 string", Offset: 13, Path: "foo.bar"}},
 
+	{"test43.bson", &SyntaxError{msg: "corrupt BSON reading utf8 string", Offset: 4}},
+	{"test44.bson", &SyntaxError{msg: "corrupt BSON reading dbpointer", Offset: 4}},
+	{"test45.bson", &SyntaxError{msg: "corrupt BSON reading dbpointer", Offset: 4}},
+	{"test57.bson", &SyntaxError{msg: "corrupt BSON reading deprecated binary", Offset: 4, Path: "binary"}},
+	{"binary_short.bson", &SyntaxError{msg: "corrupt BSON reading deprecated binary", Offset: 4, Path: "x"}},
+	{"binary_negative.bson", &SyntaxError{msg: "corrupt BSON reading binary", Offset: 4, Path: "x"}},
 }
 
 func TestLibBSONError(t *testing.T) {
@@ -236,3 +258,257 @@ func TestLibBSONError(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorTypes(t *testing.T) {
+	doc := []byte("\x0e\x00\x00\x00\x10int\x00\x01\x00\x00\x00\x00")
+	var m map[string]interface{}
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{Unmarshal(doc, nil), &InvalidUnmarshalError{}},
+		{Unmarshal(doc, m), &InvalidUnmarshalError{Type: reflect.TypeOf(m)}},
+		{Unmarshal(doc, (*map[string]interface{})(nil)), &InvalidUnmarshalError{Type: reflect.TypeOf(&m)}},
+		{Unmarshal([]byte("\x0c\x00\x00\x00\x20bad\x00\x00\x00"), &m), &InvalidBSONTypeError{Type: 0x20}},
+		{func() error { _, err := Marshal(42); return err }(), &UnsupportedTypeError{Type: reflect.TypeOf(42)}},
+		{func() error { _, err := Marshal(M{"c": make(chan int)}); return err }(), &UnsupportedTypeError{Type: reflect.TypeOf(make(chan int))}},
+		{func() error { _, err := Marshal(map[int]string{1: "x"}); return err }(), &UnsupportedTypeError{Type: reflect.TypeOf(map[int]string{})}},
+		{func() error { _, err := Marshal(M{"m": map[int]string{1: "x"}}); return err }(), &UnsupportedTypeError{Type: reflect.TypeOf(map[int]string{})}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.want, tt.err) {
+			t.Errorf("expected %v, got %v", tt.want, tt.err)
+		}
+	}
+}
+
+// celsius marshals itself as a BSON double.
+type celsius float64
+
+func (c celsius) MarshalBSONValue() (byte, []byte, error) {
+	var w writer
+	w.writeFloat64(float64(c))
+	return 0x01, w.bson, nil
+}
+
+func (c *celsius) UnmarshalBSONValue(typ byte, b []byte) error {
+	if typ != 0x01 {
+		return errors.New("celsius: want double, got " + typeName(typ))
+	}
+	*c = celsius(math.Float64frombits(uint64(readInt64(b))))
+	return nil
+}
+
+// point marshals itself as a document holding a two element array.
+type point struct{ X, Y int32 }
+
+func (p point) MarshalBSON() ([]byte, error) {
+	return Marshal(M{"xy": []interface{}{p.X, p.Y}})
+}
+
+func (p *point) UnmarshalBSON(b []byte) error {
+	var m struct{ XY []interface{} }
+	if err := Unmarshal(b, &m); err != nil {
+		return err
+	}
+	if len(m.XY) != 2 {
+		return errors.New("point: want two coordinates")
+	}
+	p.X, p.Y = m.XY[0].(int32), m.XY[1].(int32)
+	return nil
+}
+
+type brokenMarshaler struct{}
+
+func (brokenMarshaler) MarshalBSON() ([]byte, error) { return nil, errors.New("broken") }
+
+// corruptValueMarshaler returns a string value without its length prefix.
+type corruptValueMarshaler struct{}
+
+func (corruptValueMarshaler) MarshalBSONValue() (byte, []byte, error) {
+	return 0x02, []byte{0xff, 0xff}, nil
+}
+
+func TestMarshalerRoundTrip(t *testing.T) {
+	type reading struct {
+		Temp  celsius
+		Where point
+		Max   *celsius
+	}
+	max := celsius(40.5)
+	want := reading{Temp: 21.5, Where: point{3, 4}, Max: &max}
+	data, err := Marshal(&want)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got reading
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	var p point
+	if err := Unmarshal(data, &struct{ Temp *point }{&p}); err == nil {
+		t.Errorf("Unmarshal: expected error decoding double into point")
+	}
+
+	_, err = Marshal(M{"broken": brokenMarshaler{}})
+	var merr *MarshalerError
+	if !errors.As(err, &merr) || merr.Err.Error() != "broken" {
+		t.Errorf("Marshal: expected MarshalerError, got %v", err)
+	}
+	if b, err := Marshal(M{"corrupt": corruptValueMarshaler{}}); !errors.As(err, &merr) {
+		t.Errorf("Marshal: expected MarshalerError for corrupt value, got %q, %v", b, err)
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	type blob struct {
+		Raw  []byte
+		UUID Binary
+		Old  Binary
+	}
+	want := blob{
+		Raw:  []byte("raw"),
+		UUID: Binary{Subtype: 0x04, Data: []byte("0123456789abcdef")},
+		Old:  Binary{Subtype: 0x02, Data: []byte("1234")},
+	}
+	data, err := Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got blob
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	m := make(map[string]interface{})
+	if err := Unmarshal(data, &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if raw, ok := m["Raw"].([]byte); !ok || string(raw) != "raw" {
+		t.Errorf("expected Raw to decode as []byte, got %#v", m["Raw"])
+	}
+}
+
+func TestLegacyTypesRoundTrip(t *testing.T) {
+	type legacy struct {
+		Code  JavaScript
+		Scope CodeWithScope
+		Sym   Symbol
+		Ptr   DBPointer
+	}
+	in := legacy{
+		Code:  "function() {}",
+		Scope: CodeWithScope{Code: "x + y", Scope: struct{ X, Y int32 }{1, 2}},
+		Sym:   "sym",
+		Ptr:   DBPointer{Ref: "db.coll", ID: ObjectId{1, 2, 3}},
+	}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got legacy
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := in
+	want.Scope.Scope = map[string]interface{}{"X": int32(1), "Y": int32(2)}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestSentinelRoundTrip(t *testing.T) {
+	in := struct {
+		Lo, Hi, Old interface{}
+	}{MinKey{}, MaxKey{}, Undefined{}}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := []byte("\x12\x00\x00\x00\xffLo\x00\x7fHi\x00\x06Old\x00\x00")
+	if !reflect.DeepEqual(want, data) {
+		t.Errorf("Marshal: expected %q, got %q", want, data)
+	}
+	m := make(map[string]interface{})
+	if err := Unmarshal(data, &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if m["Lo"] != (MinKey{}) || m["Hi"] != (MaxKey{}) || m["Old"] != (Undefined{}) {
+		t.Errorf("Unmarshal: got %#v", m)
+	}
+}
+
+func TestDRoundTrip(t *testing.T) {
+	d := D{
+		{"z", int32(1)},
+		{"a", D{{"y", "b"}, {"x", nil}}},
+		{"m", []interface{}{D{{"k", true}}}},
+	}
+	data, err := Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := []byte("\x34\x00\x00\x00" +
+		"\x10z\x00\x01\x00\x00\x00" +
+		"\x03a\x00\x11\x00\x00\x00\x02y\x00\x02\x00\x00\x00b\x00\x0ax\x00\x00" +
+		"\x04m\x00\x11\x00\x00\x00\x030\x00\x09\x00\x00\x00\x08k\x00\x01\x00\x00" +
+		"\x00")
+	if !reflect.DeepEqual(want, data) {
+		t.Errorf("Marshal: expected %q, got %q", want, data)
+	}
+	var got D
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(d, got) {
+		t.Errorf("Unmarshal: expected %v, got %v", d, got)
+	}
+
+	var s struct{ A D }
+	if err := Unmarshal(data, &s); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(d[1].Value, s.A) {
+		t.Errorf("Unmarshal: expected %v, got %v", d[1].Value, s.A)
+	}
+}
+
+var datetimeTests = []struct {
+	t  time.Time
+	dt Datetime
+}{
+	{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 0},
+	{time.Date(2016, 11, 21, 10, 30, 0, 123456789, time.UTC), 1479724200123},
+	{time.Date(1969, 12, 31, 23, 59, 59, 999999999, time.UTC), -1},
+	{time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), -2208988800000},
+	{time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC), -62135596800000},
+}
+
+func TestDatetime(t *testing.T) {
+	for _, tt := range datetimeTests {
+		if got := NewDatetime(tt.t); got != tt.dt {
+			t.Errorf("NewDatetime(%v): expected %d, got %d", tt.t, tt.dt, got)
+		}
+		want := tt.t.Truncate(time.Millisecond)
+		if got := tt.dt.Time(); !got.Equal(want) {
+			t.Errorf("Datetime(%d).Time(): expected %v, got %v", tt.dt, want, got)
+		}
+		data, err := Marshal(struct{ T time.Time }{tt.t})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		var v struct{ T *time.Time }
+		if err := Unmarshal(data, &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if !v.T.Equal(want) {
+			t.Errorf("Unmarshal: expected %v, got %v", want, v.T)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Command bsondump prints the BSON documents in a file, or read from
+// standard input, as Extended JSON or as an indented debug view.
+//
+// Usage:
+//
+//	bsondump [flags] [file]
+//
+// The input is a stream of concatenated BSON documents, such as the output
+// of mongodump. By default each document is printed on its own line as
+// relaxed Extended JSON. The flags are
+//
+//	-canonical  print canonical rather than relaxed Extended JSON
+//	-debug      print an indented view with one element per line
+//	-type       annotate each element with its BSON type; implies -debug
+//	-offset     prefix each element with its offset in the input; implies -debug
+//	-count      print only the number of documents
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/bson"
+)
+
+type options struct {
+	canonical bool
+	debug     bool
+	types     bool
+	offsets   bool
+	count     bool
+}
+
+func main() {
+	var opts options
+	flag.BoolVar(&opts.canonical, "canonical", false, "print canonical rather than relaxed Extended JSON")
+	flag.BoolVar(&opts.debug, "debug", false, "print an indented view with one element per line")
+	flag.BoolVar(&opts.types, "type", false, "annotate each element with its BSON type; implies -debug")
+	flag.BoolVar(&opts.offsets, "offset", false, "prefix each element with its offset in the input; implies -debug")
+	flag.BoolVar(&opts.count, "count", false, "print only the number of documents")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: bsondump [flags] [file]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	in := io.Reader(os.Stdin)
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		in = f
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	err := dump(out, in, opts)
+	if ferr := out.Flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "bsondump:", err)
+	os.Exit(1)
+}
+
+// dump writes the documents read from r to w as described by opts. The
+// documents are checked only as far as is needed to print them, so ones
+// which bsonvalidate would reject, for example for holding invalid UTF-8,
+// can still be inspected.
+func dump(w io.Writer, r io.Reader, opts options) error {
+	dec := bson.NewDecoder(r)
+	var n, off int
+	var buf bytes.Buffer
+	for ; ; n++ {
+		var doc bson.Raw
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		buf.Reset()
+		switch {
+		case err != nil, opts.count:
+		case opts.debug || opts.types || opts.offsets:
+			fmt.Fprintf(&buf, "// document %d, %d bytes at offset %d\n", n, len(doc), off)
+			if opts.offsets {
+				fmt.Fprintf(&buf, "%08x ", off)
+			}
+			err = debugDocument(&buf, doc, false, off, 0, opts)
+			buf.WriteByte('\n')
+		default:
+			var b []byte
+			b, err = bson.MarshalExtJSON(doc, opts.canonical)
+			buf.Write(b)
+			buf.WriteByte('\n')
+		}
+		if err != nil {
+			return fmt.Errorf("document %d at offset %d: %v", n, off, err)
+		}
+		if _, err := buf.WriteTo(w); err != nil {
+			return err
+		}
+		off += len(doc)
+	}
+	if opts.count {
+		fmt.Fprintln(w, n)
+	}
+	return nil
+}
+
+// debugDocument writes the debug view of the document doc, which starts
+// at off in the input and is nested depth levels deep.
+func debugDocument(w io.Writer, doc bson.Raw, array bool, off, depth int, opts options) error {
+	if depth > bson.MaxDepth {
+		return errors.New("documents nested too deeply")
+	}
+	elems, err := doc.Elements()
+	if err != nil {
+		return err
+	}
+	open, close := "{", "}"
+	if array {
+		open, close = "[", "]"
+	}
+	if len(elems) == 0 {
+		fmt.Fprint(w, open+close)
+		return nil
+	}
+	fmt.Fprintln(w, open)
+	indent := strings.Repeat("    ", depth+1)
+	eoff := off + 4
+	for _, e := range elems {
+		voff := eoff + 1 + len(e.Key) + 1
+		if opts.offsets {
+			fmt.Fprintf(w, "%08x ", eoff)
+		}
+		fmt.Fprintf(w, "%s%q", indent, e.Key)
+		if opts.types {
+			fmt.Fprintf(w, " (%s)", e.Value.TypeName())
+		}
+		fmt.Fprint(w, ": ")
+		switch e.Value.Type {
+		case 0x03, 0x04:
+			err = debugDocument(w, bson.Raw(e.Value.Value), e.Value.Type == 0x04, voff, depth+1, opts)
+		default:
+			err = debugValue(w, e.Value, opts)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+		eoff = voff + len(e.Value.Value)
+	}
+	if opts.offsets {
+		fmt.Fprint(w, "         ")
+	}
+	fmt.Fprint(w, strings.Repeat("    ", depth)+close)
+	return nil
+}
+
+// debugValue writes v as Extended JSON.
+func debugValue(w io.Writer, v bson.RawValue, opts options) error {
+	b, err := bson.MarshalExtJSONValue(v, opts.canonical)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
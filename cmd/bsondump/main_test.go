@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/bson"
+)
+
+func TestDump(t *testing.T) {
+	doc, err := bson.Marshal(bson.D{
+		{Key: "a", Value: int32(1)},
+		{Key: "b", Value: bson.D{{Key: "c", Value: []interface{}{"x", true}}}},
+		{Key: "e", Value: bson.D{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := append(append([]byte{}, doc...), doc...)
+	tests := []struct {
+		opts options
+		want string
+	}{{
+		opts: options{},
+		want: `{"a":1,"b":{"c":["x",true]},"e":{}}` + "\n" +
+			`{"a":1,"b":{"c":["x",true]},"e":{}}` + "\n",
+	}, {
+		opts: options{canonical: true, count: true},
+		want: "2\n",
+	}, {
+		opts: options{canonical: true, types: true},
+		want: `// document 0, 49 bytes at offset 0
+{
+    "a" (int32): {"$numberInt":"1"}
+    "b" (document): {
+        "c" (array): [
+            "0" (string): "x"
+            "1" (bool): true
+        ]
+    }
+    "e" (document): {}
+}
+// document 1, 49 bytes at offset 49
+{
+    "a" (int32): {"$numberInt":"1"}
+    "b" (document): {
+        "c" (array): [
+            "0" (string): "x"
+            "1" (bool): true
+        ]
+    }
+    "e" (document): {}
+}
+`,
+	}, {
+		opts: options{offsets: true},
+		want: `// document 0, 49 bytes at offset 0
+00000000 {
+00000004     "a": 1
+0000000b     "b": {
+00000012         "c": [
+00000019             "0": "x"
+00000022             "1": true
+                 ]
+             }
+00000028     "e": {}
+         }
+// document 1, 49 bytes at offset 49
+00000031 {
+00000035     "a": 1
+0000003c     "b": {
+00000043         "c": [
+0000004a             "0": "x"
+00000053             "1": true
+                 ]
+             }
+00000059     "e": {}
+         }
+`,
+	}}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := dump(&buf, bytes.NewReader(input), tt.opts); err != nil {
+			t.Errorf("dump(%+v): %v", tt.opts, err)
+			continue
+		}
+		if buf.String() != tt.want {
+			t.Errorf("dump(%+v):\nexpected\n%s\ngot\n%s", tt.opts, tt.want, buf.String())
+		}
+	}
+}
+
+func TestDumpInvalid(t *testing.T) {
+	// invalid UTF-8 is printed, as bsondump is for inspecting such data
+	var buf bytes.Buffer
+	input := "\x0e\x00\x00\x00\x02s\x00\x02\x00\x00\x00\xff\x00\x00"
+	if err := dump(&buf, strings.NewReader(input), options{}); err != nil {
+		t.Errorf("dump: %v", err)
+	}
+	if want := "{\"s\":\"\ufffd\"}\n"; buf.String() != want {
+		t.Errorf("dump: expected %q, got %q", want, buf.String())
+	}
+
+	// an embedded document without its trailing 0x00 cannot be printed
+	input = "\x0d\x00\x00\x00\x03d\x00\x05\x00\x00\x00\x01\x00"
+	for _, opts := range []options{{}, {debug: true}} {
+		buf.Reset()
+		err := dump(&buf, strings.NewReader(input), opts)
+		if err == nil || !strings.Contains(err.Error(), "document 0 at offset 0") {
+			t.Errorf("dump(%+v): expected error for document 0, got %v", opts, err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("dump(%+v): expected no output, got %q", opts, buf.String())
+		}
+	}
+}
+
+func TestDumpStream(t *testing.T) {
+	f, err := os.Open("../../testdata/stream.bson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	if err := dump(&buf, f, options{count: true}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "1000\n" {
+		t.Errorf("expected 1000 documents, got %s", buf.String())
+	}
+
+	f, err = os.Open("../../testdata/stream_corrupt.bson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	err = dump(&buf, f, options{count: true})
+	if err == nil || !strings.Contains(err.Error(), "document 1000 at offset 5000") {
+		t.Errorf("expected error reading document 1000, got %v", err)
+	}
+}
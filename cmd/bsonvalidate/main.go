@@ -0,0 +1,85 @@
+// Command bsonvalidate checks that files of BSON documents conform strictly
+// to the BSON specification, as described by bson.Validate.
+//
+// Usage:
+//
+//	bsonvalidate [-v] [file ...]
+//
+// Each file, or standard input if none are given, may hold a stream of
+// concatenated documents. The first invalid document in a file is
+// reported with its index and offset, and checking of that file stops
+// there, since the framing of the documents after it cannot be trusted.
+// bsonvalidate exits with status 1 if any file was invalid. The -v flag
+// also reports the files which are valid.
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/bson"
+)
+
+func main() {
+	verbose := flag.Bool("v", false, "report valid files")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: bsonvalidate [-v] [file ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	status := 0
+	check := func(name string, r io.Reader) {
+		n, err := validate(r)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			status = 1
+		case *verbose:
+			fmt.Printf("%s: ok, %d documents\n", name, n)
+		}
+	}
+	if flag.NArg() == 0 {
+		check("<stdin>", os.Stdin)
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		check(name, f)
+		f.Close()
+	}
+	os.Exit(status)
+}
+
+// validate checks each document in the stream read from r, returning the
+// number of documents or the first error found.
+func validate(r io.Reader) (int, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for off := 0; off < len(data); n++ {
+		if len(data)-off < 4 {
+			return n, fmt.Errorf("document %d at offset %d: %v", n, off, io.ErrUnexpectedEOF)
+		}
+		size := int(int32(binary.LittleEndian.Uint32(data[off:])))
+		if size < 5 || size > len(data)-off {
+			// let Validate describe the problem
+			size = len(data) - off
+		}
+		if err := bson.Validate(data[off : off+size]); err != nil {
+			return n, fmt.Errorf("document %d at offset %d: %v", n, off, err)
+		}
+		off += size
+	}
+	return n, nil
+}
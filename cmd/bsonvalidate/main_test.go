@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		f   string
+		n   int
+		err string
+	}{
+		{"stream.bson", 1000, ""},
+		{"test1.bson", 1, ""},
+		{"stream_corrupt.bson", 1000, "document 1000 at offset 5000: unexpected EOF"},
+		{"trailingnull.bson", 0, "document 0 at offset 0: bson: string not NUL-terminated at offset 14 (a)"},
+		{"overflow1.bson", 0, "document 0 at offset 0: bson: document length does not match header at offset 0"},
+	}
+	for _, tt := range tests {
+		f, err := os.Open(filepath.Join("..", "..", "testdata", tt.f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := validate(f)
+		f.Close()
+		if n != tt.n {
+			t.Errorf("%s: expected %d valid documents, got %d", tt.f, tt.n, n)
+		}
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: expected error %q, got %v", tt.f, tt.err, err)
+		}
+	}
+}
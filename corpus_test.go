@@ -0,0 +1,306 @@
+package bson
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// corpusFile is a test file from the BSON corpus, vendored in
+// testdata/bson-corpus. See the README there for the format.
+//
+// Files marked deprecated test types which drivers may convert to their
+// modern equivalents, giving converted_bson and converted_extjson. This
+// package keeps the deprecated types, so it checks only that the
+// converted forms agree with each other.
+type corpusFile struct {
+	Description string `json:"description"`
+	BSONType    string `json:"bson_type"`
+	TestKey     string `json:"test_key"`
+	Deprecated  bool   `json:"deprecated"`
+	Valid       []struct {
+		Description       string `json:"description"`
+		CanonicalBSON     string `json:"canonical_bson"`
+		CanonicalExtJSON  string `json:"canonical_extjson"`
+		RelaxedExtJSON    string `json:"relaxed_extjson"`
+		DegenerateBSON    string `json:"degenerate_bson"`
+		DegenerateExtJSON string `json:"degenerate_extjson"`
+		ConvertedBSON     string `json:"converted_bson"`
+		ConvertedExtJSON  string `json:"converted_extjson"`
+		Lossy             bool   `json:"lossy"`
+	} `json:"valid"`
+	DecodeErrors []struct {
+		Description string `json:"description"`
+		BSON        string `json:"bson"`
+	} `json:"decodeErrors"`
+	ParseErrors []struct {
+		Description string `json:"description"`
+		String      string `json:"string"`
+	} `json:"parseErrors"`
+}
+
+func TestCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "bson-corpus", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no corpus files found")
+	}
+	// cases of our own, kept apart so the upstream files stay verbatim
+	local, err := filepath.Glob(filepath.Join("testdata", "bson-corpus-local", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range append(files, local...) {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cf corpusFile
+		if err := json.Unmarshal(data, &cf); err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(f), ".json")
+		t.Run(name, func(t *testing.T) {
+			testCorpusValid(t, name, &cf)
+			testCorpusDecodeErrors(t, name, &cf)
+			testCorpusParseErrors(t, name, &cf)
+		})
+	}
+}
+
+// corpusSkip lists the cases, by file and description, which this package
+// deliberately fails, with the reason why.
+var corpusSkip = map[string]string{
+	"top: Bad $date (number, not string or hash)": `UnmarshalExtJSON accepts the legacy {"$date": <number>} form`,
+}
+
+// skipCorpus reports whether the case desc from the file name is listed
+// in corpusSkip, logging the reason if so.
+func skipCorpus(t *testing.T, name, desc string) bool {
+	reason, ok := corpusSkip[name+": "+desc]
+	if ok {
+		t.Logf("%s: skipped: %s", desc, reason)
+	}
+	return ok
+}
+
+func testCorpusValid(t *testing.T, name string, cf *corpusFile) {
+	for _, tt := range cf.Valid {
+		if skipCorpus(t, name, tt.Description) {
+			continue
+		}
+		cB := mustHex(t, tt.CanonicalBSON)
+
+		// native round trips
+		corpusRoundTrip(t, tt.Description, cB, cB)
+		if tt.DegenerateBSON != "" {
+			corpusRoundTrip(t, tt.Description+" (degenerate)", mustHex(t, tt.DegenerateBSON), cB)
+		}
+
+		// BSON to Extended JSON
+		corpusExtJSON(t, tt.Description, cB, true, tt.CanonicalExtJSON)
+		if tt.RelaxedExtJSON != "" {
+			corpusExtJSON(t, tt.Description, cB, false, tt.RelaxedExtJSON)
+		}
+		if tt.DegenerateBSON != "" {
+			corpusExtJSON(t, tt.Description+" (degenerate)", mustHex(t, tt.DegenerateBSON), true, tt.CanonicalExtJSON)
+		}
+
+		// Extended JSON to BSON
+		if !tt.Lossy {
+			corpusParse(t, tt.Description, tt.CanonicalExtJSON, cB)
+			if tt.DegenerateExtJSON != "" {
+				corpusParse(t, tt.Description+" (degenerate)", tt.DegenerateExtJSON, cB)
+			}
+		}
+		if tt.RelaxedExtJSON != "" {
+			b, err := UnmarshalExtJSON([]byte(tt.RelaxedExtJSON))
+			if err != nil {
+				t.Errorf("%s: UnmarshalExtJSON(%s): %v", tt.Description, tt.RelaxedExtJSON, err)
+				continue
+			}
+			corpusExtJSON(t, tt.Description+" (relaxed round trip)", b, false, tt.RelaxedExtJSON)
+		}
+
+		if tt.ConvertedBSON != "" {
+			xB := mustHex(t, tt.ConvertedBSON)
+			corpusRoundTrip(t, tt.Description+" (converted)", xB, xB)
+			corpusExtJSON(t, tt.Description+" (converted)", xB, true, tt.ConvertedExtJSON)
+			corpusParse(t, tt.Description+" (converted)", tt.ConvertedExtJSON, xB)
+		}
+	}
+}
+
+// corpusRoundTrip checks that b decodes into a D which encodes as want.
+func corpusRoundTrip(t *testing.T, desc string, b, want []byte) {
+	var d D
+	if err := Unmarshal(b, &d); err != nil {
+		t.Errorf("%s: Unmarshal(%X): %v", desc, b, err)
+		return
+	}
+	got, err := Marshal(d)
+	if err != nil {
+		t.Errorf("%s: Marshal(%v): %v", desc, d, err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: native round trip of %X:\nexpected %X\n     got %X", desc, b, want, got)
+	}
+}
+
+// corpusExtJSON checks that b renders as the Extended JSON want.
+func corpusExtJSON(t *testing.T, desc string, b []byte, canonical bool, want string) {
+	got, err := MarshalExtJSON(Raw(b), canonical)
+	if err != nil {
+		t.Errorf("%s: MarshalExtJSON(%X, %v): %v", desc, b, canonical, err)
+		return
+	}
+	if !jsonEqual(t, string(got), want) {
+		t.Errorf("%s: MarshalExtJSON(%X, %v):\nexpected %s\n     got %s", desc, b, canonical, want, got)
+	}
+}
+
+// corpusParse checks that the Extended JSON s parses as want.
+func corpusParse(t *testing.T, desc string, s string, want []byte) {
+	got, err := UnmarshalExtJSON([]byte(s))
+	if err != nil {
+		t.Errorf("%s: UnmarshalExtJSON(%s): %v", desc, s, err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: UnmarshalExtJSON(%s):\nexpected %X\n     got %X", desc, s, want, got)
+	}
+}
+
+// corpusLenient lists the decodeErrors cases, by file and description,
+// which Unmarshal accepts. Unmarshal checks only what it needs to walk
+// the document, leaving the rest to Validate: it trusts the length and
+// trailing 0x00 of the outermost document, which the Decoder has already
+// framed, and does not check booleans or the UTF-8 and NUL terminators of
+// strings.
+var corpusLenient = map[string]bool{
+	"boolean: Invalid boolean value of 2":      true,
+	"boolean: Invalid boolean value of -1":     true,
+	"code: code string is not null-terminated": true,
+	"code: invalid UTF-8":                      true,
+	"dbpointer: String not null terminated":    true,
+	"dbpointer: String with bad UTF-8":         true,
+	"string: string is not null-terminated":    true,
+	"string: invalid UTF-8":                    true,
+	"symbol: symbol is not null-terminated":    true,
+	"symbol: invalid UTF-8":                    true,
+	"top: An object size that's too small to even include the object size, but is a well-formed, empty object": true,
+	"top: An object size that's only enough for the object size, but is a well-formed, empty object":           true,
+	"top: One object, sized correctly, with a spot for an EOO, but the EOO is 0x01":                            true,
+	"top: One object, sized correctly, with a spot for an EOO, but the EOO is 0xff":                            true,
+	"top: One object, sized correctly, with a spot for an EOO, but the EOO is 0x70":                            true,
+	"top: Stated length exceeds byte count, with valid envelope":                                               true,
+	"top: Stated length less than byte count, with valid envelope":                                             true,
+}
+
+func testCorpusDecodeErrors(t *testing.T, name string, cf *corpusFile) {
+	for _, tt := range cf.DecodeErrors {
+		if skipCorpus(t, name, tt.Description) {
+			continue
+		}
+		b := mustHex(t, tt.BSON)
+		switch err := corpusCall(func() error { return Validate(b) }); {
+		case err == errCorpusPanic:
+			t.Errorf("%s: Validate(%X): panicked", tt.Description, b)
+		case err == nil:
+			t.Errorf("%s: Validate(%X): expected error", tt.Description, b)
+		}
+		err := corpusCall(func() error {
+			m := make(map[string]interface{})
+			return Unmarshal(b, &m)
+		})
+		switch lenient := corpusLenient[name+": "+tt.Description]; {
+		case err == errCorpusPanic:
+			t.Errorf("%s: Unmarshal(%X): panicked", tt.Description, b)
+		case err == nil && !lenient:
+			t.Errorf("%s: Unmarshal(%X): expected error", tt.Description, b)
+		case err != nil && lenient:
+			t.Errorf("%s: Unmarshal(%X): listed as lenient, but returned %v", tt.Description, b, err)
+		}
+	}
+}
+
+var errCorpusPanic = errors.New("panic")
+
+// corpusCall returns the result of f, or errCorpusPanic if f panics, so
+// that one bad case does not hide the rest.
+func corpusCall(f func() error) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = errCorpusPanic
+		}
+	}()
+	return f()
+}
+
+func testCorpusParseErrors(t *testing.T, name string, cf *corpusFile) {
+	for _, tt := range cf.ParseErrors {
+		if skipCorpus(t, name, tt.Description) {
+			continue
+		}
+		var err error
+		if cf.BSONType == "0x13" {
+			_, err = ParseDecimal128(tt.String)
+		} else {
+			_, err = UnmarshalExtJSON([]byte(tt.String))
+		}
+		if err == nil {
+			t.Errorf("%s: parsing %q: expected error", tt.Description, tt.String)
+		}
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+// jsonEqual reports whether the JSON texts a and b are the same, ignoring
+// whitespace and differences in string escaping but not the order of
+// object keys or the formatting of numbers.
+func jsonEqual(t *testing.T, a, b string) bool {
+	ta, err := jsonTokens(a)
+	if err != nil {
+		t.Errorf("invalid JSON %s: %v", a, err)
+		return false
+	}
+	tb, err := jsonTokens(b)
+	if err != nil {
+		t.Errorf("invalid JSON %s: %v", b, err)
+		return false
+	}
+	return reflect.DeepEqual(ta, tb)
+}
+
+func jsonTokens(s string) ([]json.Token, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var tokens []json.Token
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+	}
+}
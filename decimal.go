@@ -0,0 +1,345 @@
+package bson
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal128 represents a BSON 128-bit IEEE 754-2008 decimal floating point
+// value, stored in the binary integer decimal encoding used on the wire.
+type Decimal128 struct {
+	h, l uint64
+}
+
+const (
+	decimal128Bias   = 6176
+	decimal128MaxExp = 6111
+	decimal128MinExp = -6176
+	decimal128Digits = 34
+)
+
+var (
+	// decimal128MaxCoeff is the largest coefficient a Decimal128 may hold,
+	// 10^34 - 1.
+	decimal128MaxCoeff = new(big.Int).Sub(new(big.Int).Exp(big.NewInt(10), big.NewInt(decimal128Digits), nil), big.NewInt(1))
+
+	errDecimal128NaN      = errors.New("bson: Decimal128 is NaN")
+	errDecimal128Infinity = errors.New("bson: Decimal128 is infinite")
+)
+
+// NewDecimal128 returns the Decimal128 whose high and low 64 bits are h
+// and l.
+func NewDecimal128(h, l uint64) Decimal128 {
+	return Decimal128{h: h, l: l}
+}
+
+// GetBytes returns the high and low 64 bits of d.
+func (d Decimal128) GetBytes() (uint64, uint64) {
+	return d.h, d.l
+}
+
+// IsNaN reports whether d is a quiet or signalling NaN.
+func (d Decimal128) IsNaN() bool {
+	return d.h>>58&0x1f == 0x1f
+}
+
+// IsInf reports whether d is an infinity, according to sign.
+// If sign > 0, IsInf reports whether d is positive infinity.
+// If sign < 0, IsInf reports whether d is negative infinity.
+// If sign == 0, IsInf reports whether d is either infinity.
+func (d Decimal128) IsInf(sign int) bool {
+	if d.h>>58&0x1f != 0x1e {
+		return false
+	}
+	neg := d.h>>63 == 1
+	return sign == 0 || sign > 0 && !neg || sign < 0 && neg
+}
+
+// decompose returns the sign, coefficient and exponent of a finite d.
+// Coefficients larger than the maximum are non-canonical and treated as zero.
+func (d Decimal128) decompose() (bool, *big.Int, int) {
+	neg := d.h>>63 == 1
+	coeff := new(big.Int)
+	var exp int
+	if d.h>>61&3 == 3 {
+		// the implied coefficient is always larger than 10^34 - 1.
+		exp = int(d.h>>47&(1<<14-1)) - decimal128Bias
+		return neg, coeff, exp
+	}
+	exp = int(d.h>>49&(1<<14-1)) - decimal128Bias
+	coeff.SetUint64(d.h & (1<<49 - 1))
+	coeff.Lsh(coeff, 64)
+	coeff.Or(coeff, new(big.Int).SetUint64(d.l))
+	if coeff.Cmp(decimal128MaxCoeff) > 0 {
+		coeff.SetInt64(0)
+	}
+	return neg, coeff, exp
+}
+
+// String returns the string representation of d, using scientific notation
+// when the exponent is positive or the value is very small, as described
+// by the IEEE 754-2008 to-scientific-string operation.
+func (d Decimal128) String() string {
+	switch {
+	case d.IsNaN():
+		return "NaN"
+	case d.IsInf(1):
+		return "Infinity"
+	case d.IsInf(-1):
+		return "-Infinity"
+	}
+	neg, coeff, exp := d.decompose()
+	digits := coeff.String()
+	adjusted := exp + len(digits) - 1
+
+	var s string
+	switch {
+	case exp > 0 || adjusted < -6:
+		s = digits[:1]
+		if len(digits) > 1 {
+			s += "." + digits[1:]
+		}
+		s += "E"
+		if adjusted >= 0 {
+			s += "+"
+		}
+		s += strconv.Itoa(adjusted)
+	case exp == 0:
+		s = digits
+	case len(digits) > -exp:
+		s = digits[:len(digits)+exp] + "." + digits[len(digits)+exp:]
+	default:
+		s = "0." + strings.Repeat("0", -exp-len(digits)) + digits
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// ParseDecimal128 parses s as a decimal number. It accepts the forms
+// produced by String, plain decimals, exponents in either case, and the
+// case-insensitive special values "NaN", "Inf" and "Infinity". An error
+// is returned if s cannot be represented exactly.
+func ParseDecimal128(s string) (Decimal128, error) {
+	orig := s
+	var neg bool
+	switch {
+	case strings.HasPrefix(s, "-"):
+		neg, s = true, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	switch strings.ToLower(s) {
+	case "nan":
+		return Decimal128{h: 0x1f << 58}, nil
+	case "inf", "infinity":
+		d := Decimal128{h: 0x1e << 58}
+		if neg {
+			d.h |= 1 << 63
+		}
+		return d, nil
+	}
+
+	var exp int
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil || i == 0 {
+			return Decimal128{}, decimal128SyntaxError(orig)
+		}
+		exp, s = e, s[:i]
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		exp -= len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+	if s == "" {
+		return Decimal128{}, decimal128SyntaxError(orig)
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return Decimal128{}, decimal128SyntaxError(orig)
+		}
+	}
+	s = strings.TrimLeft(s, "0")
+	if s == "" {
+		s = "0"
+	}
+	// drop trailing zeros which do not fit in the coefficient
+	for len(s) > decimal128Digits && s[len(s)-1] == '0' {
+		s = s[:len(s)-1]
+		exp++
+	}
+	if len(s) > decimal128Digits {
+		return Decimal128{}, decimal128RangeError(orig)
+	}
+	coeff, _ := new(big.Int).SetString(s, 10)
+	d, ok := newDecimal128(neg, coeff, exp)
+	if !ok {
+		return Decimal128{}, decimal128RangeError(orig)
+	}
+	return d, nil
+}
+
+func decimal128SyntaxError(s string) error {
+	return errors.New("bson: cannot parse " + strconv.Quote(s) + " as Decimal128")
+}
+
+func decimal128RangeError(s string) error {
+	return errors.New("bson: " + strconv.Quote(s) + " cannot be represented exactly as Decimal128")
+}
+
+// newDecimal128 returns the Decimal128 for -1^neg * coeff * 10^exp,
+// clamping the exponent into range where that can be done exactly.
+// coeff is modified.
+func newDecimal128(neg bool, coeff *big.Int, exp int) (Decimal128, bool) {
+	ten := big.NewInt(10)
+	if coeff.Sign() == 0 {
+		switch {
+		case exp > decimal128MaxExp:
+			exp = decimal128MaxExp
+		case exp < decimal128MinExp:
+			exp = decimal128MinExp
+		}
+	}
+	if exp > decimal128MaxExp+decimal128Digits {
+		return Decimal128{}, false
+	}
+	for exp > decimal128MaxExp {
+		coeff.Mul(coeff, ten)
+		exp--
+	}
+	var m big.Int
+	for exp < decimal128MinExp {
+		var q big.Int
+		q.QuoRem(coeff, ten, &m)
+		if m.Sign() != 0 {
+			return Decimal128{}, false
+		}
+		coeff.Set(&q)
+		exp++
+	}
+	if coeff.Cmp(decimal128MaxCoeff) > 0 {
+		return Decimal128{}, false
+	}
+	var lo big.Int
+	lo.And(coeff, new(big.Int).SetUint64(1<<64-1))
+	d := Decimal128{
+		h: new(big.Int).Rsh(coeff, 64).Uint64() | uint64(exp+decimal128Bias)<<49,
+		l: lo.Uint64(),
+	}
+	if neg {
+		d.h |= 1 << 63
+	}
+	return d, true
+}
+
+// BigInt returns the coefficient and exponent of d, such that the value
+// of d is coefficient * 10^exponent. An error is returned if d is NaN or
+// infinite. The sign of a negative zero is lost.
+func (d Decimal128) BigInt() (*big.Int, int, error) {
+	switch {
+	case d.IsNaN():
+		return nil, 0, errDecimal128NaN
+	case d.IsInf(0):
+		return nil, 0, errDecimal128Infinity
+	}
+	neg, coeff, exp := d.decompose()
+	if neg {
+		coeff.Neg(coeff)
+	}
+	return coeff, exp, nil
+}
+
+// NewDecimal128FromBigInt returns the Decimal128 for coeff * 10^exp. An
+// error is returned if the value cannot be represented exactly.
+func NewDecimal128FromBigInt(coeff *big.Int, exp int) (Decimal128, error) {
+	c := new(big.Int).Abs(coeff)
+	d, ok := newDecimal128(coeff.Sign() < 0, c, exp)
+	if !ok {
+		return Decimal128{}, errors.New("bson: " + coeff.String() + "E" + strconv.Itoa(exp) + " cannot be represented exactly as Decimal128")
+	}
+	return d, nil
+}
+
+// BigFloat returns the value of d as a *big.Float. Values with a negative
+// exponent are rounded to the nearest value with 128 bits of precision.
+// An error is returned if d is NaN; infinities are returned as the
+// corresponding infinite *big.Float.
+func (d Decimal128) BigFloat() (*big.Float, error) {
+	switch {
+	case d.IsNaN():
+		return nil, errDecimal128NaN
+	case d.IsInf(1):
+		return new(big.Float).SetInf(false), nil
+	case d.IsInf(-1):
+		return new(big.Float).SetInf(true), nil
+	}
+	neg, coeff, exp := d.decompose()
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exp))), nil)
+	f := new(big.Float)
+	if exp >= 0 {
+		f.SetInt(coeff.Mul(coeff, pow))
+	} else {
+		f.SetPrec(128).Quo(new(big.Float).SetInt(coeff), new(big.Float).SetInt(pow))
+	}
+	if neg {
+		f.Neg(f)
+	}
+	return f, nil
+}
+
+// NewDecimal128FromBigFloat returns the Decimal128 closest to f, rounded
+// half to even to 34 significant digits, or fewer where f is so small that
+// the smallest exponent leaves room for fewer. Values too small to round
+// to a non-zero Decimal128 become zero of the same sign, and values too
+// large to represent return an error.
+func NewDecimal128FromBigFloat(f *big.Float) (Decimal128, error) {
+	if f.IsInf() {
+		if f.Signbit() {
+			return Decimal128{h: 0x1e<<58 | 1<<63}, nil
+		}
+		return Decimal128{h: 0x1e << 58}, nil
+	}
+	// f.Text rounds half to even, giving -d.ddd...e±x with 34 digits
+	mant := f.Text('e', decimal128Digits-1)
+	i := strings.IndexByte(mant, 'e')
+	mant, e := mant[:i], mant[i+1:]
+	neg := mant[0] == '-'
+	if neg {
+		mant = mant[1:]
+	}
+	exp, _ := strconv.Atoi(e)
+	digits := strings.TrimRight(mant[:1]+mant[2:], "0")
+	exp -= len(digits) - 1
+	coeff, _ := new(big.Int).SetString(digits, 10)
+	if coeff == nil {
+		coeff, exp = new(big.Int), 0
+	}
+	if shift := decimal128MinExp - exp; shift > decimal128Digits {
+		coeff, exp = new(big.Int), decimal128MinExp
+	} else if shift > 0 {
+		// round off the digits below the smallest exponent
+		var r big.Int
+		pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(shift)), nil)
+		coeff.QuoRem(coeff, pow, &r)
+		if c := r.Lsh(&r, 1).Cmp(pow); c > 0 || c == 0 && coeff.Bit(0) == 1 {
+			coeff.Add(coeff, big.NewInt(1))
+		}
+		exp = decimal128MinExp
+	}
+	d, ok := newDecimal128(neg, coeff, exp)
+	if !ok {
+		return Decimal128{}, errors.New("bson: " + f.Text('g', 10) + " is too large for Decimal128")
+	}
+	return d, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,146 @@
+package bson
+
+import (
+	"math/big"
+	"testing"
+)
+
+var decimal128Tests = []struct {
+	h, l uint64
+	s    string // canonical string form
+}{
+	{0x3040000000000000, 0x0000000000000000, "0"},
+	{0xb040000000000000, 0x0000000000000000, "-0"},
+	{0x3040000000000000, 0x0000000000000001, "1"},
+	{0xb040000000000000, 0x0000000000000001, "-1"},
+	{0x303e000000000000, 0x0000000000000001, "0.1"},
+	{0x3034000000000000, 0x00000000000004d2, "0.001234"},
+	{0x3046000000000000, 0x0000000000000001, "1E+3"},
+	{0xb02c000000000000, 0x0000000000000064, "-1.00E-8"},
+	{0x5ffe000000000000, 0x000000000000000a, "1.0E+6112"},
+	{0x0000000000000000, 0x0000000000000001, "1E-6176"},
+	{0x3041ffffffffffff, 0xffffffffffffffff, "0"}, // non-canonical coefficient
+	{0x6c10000000000000, 0x0000000000000000, "0"}, // non-canonical combination
+	{0x7c00000000000000, 0x0000000000000000, "NaN"},
+	{0x7e00000000000000, 0x0000000000000000, "NaN"},
+	{0x7800000000000000, 0x0000000000000000, "Infinity"},
+	{0xf800000000000000, 0x0000000000000000, "-Infinity"},
+}
+
+func TestDecimal128String(t *testing.T) {
+	for _, tt := range decimal128Tests {
+		if got := NewDecimal128(tt.h, tt.l).String(); got != tt.s {
+			t.Errorf("NewDecimal128(%#x, %#x).String(): expected %q, got %q", tt.h, tt.l, tt.s, got)
+		}
+	}
+}
+
+var parseDecimal128Tests = []struct {
+	in  string
+	out string // expected String() of the result, or "" for an error
+}{
+	{"0", "0"},
+	{"-0.0", "-0.0"},
+	{"+1", "1"},
+	{"1.5e3", "1.5E+3"},
+	{"1500", "1500"},
+	{"0.000001", "0.000001"},
+	{"0.0000001", "1E-7"},
+	{"-100E-10", "-1.00E-8"},
+	{"1E6112", "1.0E+6112"},
+	{"0E9999", "0E+6111"},
+	{"0E-9999", "0E-6176"},
+	{"10E-6177", "1E-6176"},
+	{"1000000000000000000000000000000000000000", "1.000000000000000000000000000000000E+39"},
+	{"inf", "Infinity"},
+	{"-Infinity", "-Infinity"},
+	{"NaN", "NaN"},
+	{"1E-6177", ""},
+	{"1E6145", ""},
+	{"12345678901234567890123456789012345", ""},
+	{"", ""},
+	{".", ""},
+	{"E02", ""},
+	{"1.2.3", ""},
+	{"1e", ""},
+	{"0x10", ""},
+}
+
+func TestParseDecimal128(t *testing.T) {
+	for _, tt := range parseDecimal128Tests {
+		d, err := ParseDecimal128(tt.in)
+		if tt.out == "" {
+			if err == nil {
+				t.Errorf("ParseDecimal128(%q): expected error, got %v", tt.in, d)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDecimal128(%q): %v", tt.in, err)
+			continue
+		}
+		if got := d.String(); got != tt.out {
+			t.Errorf("ParseDecimal128(%q): expected %q, got %q", tt.in, tt.out, got)
+		}
+	}
+}
+
+func TestDecimal128Big(t *testing.T) {
+	d, _ := ParseDecimal128("-1.25E+3")
+	coeff, exp, err := d.BigInt()
+	if err != nil || coeff.Int64() != -125 || exp != 1 {
+		t.Errorf("BigInt: expected -125 1, got %v %v %v", coeff, exp, err)
+	}
+	if d2, err := NewDecimal128FromBigInt(coeff, exp); err != nil || d2 != d {
+		t.Errorf("NewDecimal128FromBigInt: expected %v, got %v %v", d, d2, err)
+	}
+	f, err := d.BigFloat()
+	if v, _ := f.Float64(); err != nil || v != -1250 {
+		t.Errorf("BigFloat: expected -1250, got %v %v", f, err)
+	}
+	d, _ = ParseDecimal128("0.5")
+	if f, _ := d.BigFloat(); f.Cmp(big.NewFloat(0.5)) != 0 {
+		t.Errorf("BigFloat: expected 0.5, got %v", f)
+	}
+	if d, err := NewDecimal128FromBigFloat(big.NewFloat(0.25)); err != nil || d.String() != "0.25" {
+		t.Errorf("NewDecimal128FromBigFloat: expected 0.25, got %v %v", d, err)
+	}
+	for _, tt := range []struct {
+		f, want string
+	}{
+		{"1e-6200", "0E-6176"},
+		{"-1e-6200", "-0E-6176"},
+		{"5e-6177", "0E-6176"},
+		{"1.5e-6176", "2E-6176"},
+		{"1.23456e-6172", "1.2346E-6172"},
+		{"1.0000000000000000000000000000000006", "1.000000000000000000000000000000001"},
+		{"1e6144", "1.000000000000000000000000000000000E+6144"},
+	} {
+		f, _, _ := big.ParseFloat(tt.f, 10, 256, big.ToNearestEven)
+		if d, err := NewDecimal128FromBigFloat(f); err != nil || d.String() != tt.want {
+			t.Errorf("NewDecimal128FromBigFloat(%s): expected %s, got %v %v", tt.f, tt.want, d, err)
+		}
+	}
+	f, _, _ = big.ParseFloat("1e6145", 10, 256, big.ToNearestEven)
+	if d, err := NewDecimal128FromBigFloat(f); err == nil {
+		t.Errorf("NewDecimal128FromBigFloat(1e6145): expected error, got %v", d)
+	}
+	if _, _, err := NewDecimal128(0x7c00000000000000, 0).BigInt(); err == nil {
+		t.Errorf("BigInt: expected error for NaN")
+	}
+}
+
+func TestDecimal128RoundTrip(t *testing.T) {
+	d, _ := ParseDecimal128("1234.5678")
+	data, err := Marshal(struct{ Price Decimal128 }{d})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	m := make(map[string]interface{})
+	if err := Unmarshal(data, &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got, ok := m["Price"].(Decimal128); !ok || got != d {
+		t.Errorf("expected %v, got %#v", d, m["Price"])
+	}
+}
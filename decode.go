@@ -6,224 +6,578 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // decode decodes data into v according to the rules detailed in Unmarshal.
 func decode(data []byte, v interface{}) error {
 	rv := reflect.ValueOf(v)
-	if rv.Kind() != reflect.Ptr {
-		return errors.New("bson: Unmarshal(non-pointer " + rv.Type().String() + ")")
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidUnmarshalError{Type: reflect.TypeOf(v)}
 	}
-	if rv.IsNil() {
-		return errors.New("bson: Unmarshal(nil " + rv.Type().String() + ")")
+	return decodeValue(rv.Elem(), 0x03, data, data, 0)
+}
+
+// errMaxDepth returns the error for a document nested more than MaxDepth
+// deep.
+func errMaxDepth() error {
+	return &SyntaxError{msg: "exceeded max depth", Offset: 0}
+}
+
+// decodeValue decodes a BSON element of type typ into v, allocating maps,
+// slices and pointers as required. element and value are the element as
+// returned by reader.Element and reader.Value respectively, and depth is
+// the nesting of the element's value within the outermost document.
+func decodeValue(v reflect.Value, typ byte, element, value []byte, depth int) error {
+	if decodeRaw(v, typ, value) {
+		return nil
 	}
-	switch rv := rv.Elem(); rv.Kind() {
-	case reflect.Struct:
-		return decodeStruct(data, rv)
-	case reflect.Map:
-		return decodeMap(data, rv)
-	default:
-		return errors.New("bson: Unmarshal(pointer " + rv.Type().String() + ")")
+	if ok, err := unmarshalHook(v, typ, value); ok {
+		return err
+	}
+	if v.Kind() == reflect.Ptr {
+		if typ == 0x0a {
+			// null
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeValue(v.Elem(), typ, element, value, depth)
+	}
+	if depth > MaxDepth && (typ == 0x03 || typ == 0x04 || typ == 0x0f) {
+		return errMaxDepth()
+	}
+	switch {
+	case typ == 0x03 && v.Type() == dType:
+		return decodeD(element, v.Addr().Interface().(*D), depth)
+	case typ == 0x03 && v.Kind() == reflect.Struct:
+		return decodeStruct(element, v, depth)
+	case typ == 0x03 && v.Kind() == reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return &UnmarshalTypeError{Value: typeName(typ), Type: v.Type()}
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		return decodeMap(element, v, depth)
+	case typ == 0x04 && (v.Kind() == reflect.Slice && v.Type() != dType || v.Kind() == reflect.Array):
+		return decodeArray(element, v, depth)
 	}
+	x, err := decodeElement(typ, element, v.Type() == dType, depth)
+	if err != nil {
+		return err
+	}
+	return setValue(v, typ, x)
 }
 
-func decodeStruct(data []byte, v reflect.Value) error {
-	iter := reader{bson: data[4 : len(data)-1]}
+func decodeStruct(data []byte, v reflect.Value, depth int) error {
+	fields := cachedTypeFields(v.Type())
+	iter := newReader(data)
 	for iter.Next() {
 		typ, ename, element := iter.Element()
-		v := v.FieldByName(string(trimlast(ename)))
-		if !v.IsValid() {
+		f := fieldByName(fields, string(trimlast(ename)))
+		if f == nil {
 			// can't match the field, skip it
 			continue
 		}
-		switch typ {
-		case 0x01:
-			// double
-			bits := uint64(element[0]) | uint64(element[1])<<8 | uint64(element[2])<<16 | uint64(element[3])<<24 | uint64(element[4])<<32 | uint64(element[5]<<40) | uint64(element[6]<<48) | uint64(element[7]<<56)
-			v.SetFloat(math.Float64frombits(bits))
-		case 0x02:
-			// utf-8 string
-			v.SetString(string(trimlast(element)))
-		case 0x03:
-			// BSON document (map)
-			m := make(map[string]interface{})
-			vv := reflect.ValueOf(m)
-			if err := decodeMap(element, vv); err != nil {
-				return err
-			}
-			v.Set(vv)
-		case 0x04:
-			// array
-			s := make([]interface{}, 0)
-			if err := decodeSlice(element, &s); err != nil {
-				return err
-			}
-			vv := reflect.ValueOf(s)
-			v.Set(vv)
-		case 0x07:
-			// object id
-			var oid ObjectId
-			copy(oid[:], element)
-			vv := reflect.ValueOf(oid)
-			v.Set(vv)
-		case 0x08:
-			// boolean
-			v.SetBool(element[0] == 1)
-		case 0x09:
-			// datetime
-			dt := Datetime(element[0]) | Datetime(element[1])<<8 | Datetime(element[2])<<16 | Datetime(element[3])<<24 | Datetime(element[4])<<32 | Datetime(element[5]<<40) | Datetime(element[6]<<48) | Datetime(element[7]<<56)
-			vv := reflect.ValueOf(dt)
-			v.Set(vv)
-		case 0x10:
-			element := int64(element[0]) | int64(element[1])<<8 | int64(element[2])<<16 | int64(element[3])<<24
-			v.SetInt(element)
-		case 0x11:
-			// timestamp
-			ts := Timestamp(element[0]) | Timestamp(element[1])<<8 | Timestamp(element[2])<<16 | Timestamp(element[3])<<24 | Timestamp(element[4])<<32 | Timestamp(element[5]<<40) | Timestamp(element[6]<<48) | Timestamp(element[7]<<56)
-			vv := reflect.ValueOf(ts)
-			v.Set(vv)
-		case 0x12:
-			element := int64(element[0]) | int64(element[1])<<8 | int64(element[2])<<16 | int64(element[3])<<24 | int64(element[4])<<32 | int64(element[5]<<40) | int64(element[6]<<48) | int64(element[7]<<56)
-			v.SetInt(element)
-		default:
-			return fmt.Errorf("bson: unknown element type %x", typ)
+		if err := decodeValue(v.Field(f.index), typ, element, iter.Value(), depth+1); err != nil {
+			return iter.annotate(err)
 		}
 	}
 	return iter.Err()
 }
 
-func decodeMap(data []byte, v reflect.Value) error {
-	iter := reader{bson: data[4 : len(data)-1]}
+// fieldByName returns the field whose name matches name, preferring an
+// exact match over a case-insensitive one. If no field matches, nil is
+// returned.
+func fieldByName(fields []field, name string) *field {
+	for i := range fields {
+		if fields[i].name == name {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, name) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// decodeMap decodes data into the map v, whose key type must be a string
+// type.
+func decodeMap(data []byte, v reflect.Value, depth int) error {
+	kt, et := v.Type().Key(), v.Type().Elem()
+	iter := newReader(data)
 	for iter.Next() {
 		typ, ename, element := iter.Element()
-		kv := reflect.ValueOf(string(trimlast(ename)))
-		switch typ {
-		case 0x01:
-			// double
-			bits := uint64(element[0]) | uint64(element[1])<<8 | uint64(element[2])<<16 | uint64(element[3])<<24 | uint64(element[4])<<32 | uint64(element[5]<<40) | uint64(element[6]<<48) | uint64(element[7]<<56)
-			vv := reflect.ValueOf(math.Float64frombits(bits))
-			v.SetMapIndex(kv, vv)
-		case 0x02:
-			// utf-8 string
-			vv := reflect.ValueOf(string(trimlast(element)))
-			v.SetMapIndex(kv, vv)
-		case 0x03:
-			// BSON document (map)
-			m := make(map[string]interface{})
-			vv := reflect.ValueOf(m)
-			if err := decodeMap(element, vv); err != nil {
-				return err
-			}
-			v.SetMapIndex(kv, vv)
-		case 0x04:
-			// array
-			s := make([]interface{}, 0)
-			if err := decodeSlice(element, &s); err != nil {
-				return err
-			}
-			vv := reflect.ValueOf(s)
-			v.SetMapIndex(kv, vv)
-		case 0x07:
-			// object id
-			var oid ObjectId
-			copy(oid[:], element)
-			vv := reflect.ValueOf(oid)
-			v.SetMapIndex(kv, vv)
-		case 0x08:
-			// boolean
-			b := element[0] == 1
-			vv := reflect.ValueOf(b)
-			v.SetMapIndex(kv, vv)
-		case 0x09:
-			// datetime
-			dt := Datetime(element[0]) | Datetime(element[1])<<8 | Datetime(element[2])<<16 | Datetime(element[3])<<24 | Datetime(element[4])<<32 | Datetime(element[5]<<40) | Datetime(element[6]<<48) | Datetime(element[7]<<56)
-			vv := reflect.ValueOf(dt)
-			v.SetMapIndex(kv, vv)
-		case 0x0a:
-			// null
-			// TODO(dfc) this is a bit of a hack, the
-			// map may not be of type map[string]interface{}
-			// the key could be a derived type of string.
-			m := v.Interface().(map[string]interface{})
-			m[string(trimlast(ename))] = nil
-		case 0x10:
-			element := int32(element[0]) | int32(element[1])<<8 | int32(element[2])<<16 | int32(element[3])<<24
-			vv := reflect.ValueOf(element)
-			v.SetMapIndex(kv, vv)
-		case 0x11:
-			// timestamp
-			ts := Timestamp(element[0]) | Timestamp(element[1])<<8 | Timestamp(element[2])<<16 | Timestamp(element[3])<<24 | Timestamp(element[4])<<32 | Timestamp(element[5]<<40) | Timestamp(element[6]<<48) | Timestamp(element[7]<<56)
-			vv := reflect.ValueOf(ts)
-			v.SetMapIndex(kv, vv)
-		case 0x12:
-			element := int64(element[0]) | int64(element[1])<<8 | int64(element[2])<<16 | int64(element[3])<<24 | int64(element[4])<<32 | int64(element[5]<<40) | int64(element[6]<<48) | int64(element[7]<<56)
-			vv := reflect.ValueOf(element)
-			v.SetMapIndex(kv, vv)
+		kv := reflect.ValueOf(string(trimlast(ename))).Convert(kt)
+		ev := reflect.New(et).Elem()
+		if err := decodeValue(ev, typ, element, iter.Value(), depth+1); err != nil {
+			return iter.annotate(err)
+		}
+		v.SetMapIndex(kv, ev)
+	}
+	return iter.Err()
+}
+
+// decodeArray decodes the elements of the BSON array data into v, which
+// must be a slice or an array. Elements beyond the length of an array are
+// discarded, and any remaining array elements are set to zero.
+func decodeArray(data []byte, v reflect.Value, depth int) error {
+	var s reflect.Value
+	if v.Kind() == reflect.Slice {
+		s = reflect.MakeSlice(v.Type(), 0, 0)
+	}
+	i := 0
+	iter := newReader(data)
+	for iter.Next() {
+		typ, _, element := iter.Element()
+		var ev reflect.Value
+		switch {
+		case v.Kind() == reflect.Slice:
+			ev = reflect.New(v.Type().Elem()).Elem()
+		case i < v.Len():
+			ev = v.Index(i)
 		default:
-			return fmt.Errorf("bson: unknown element type %x", typ)
+			continue
+		}
+		if err := decodeValue(ev, typ, element, iter.Value(), depth+1); err != nil {
+			return iter.annotate(err)
+		}
+		if v.Kind() == reflect.Slice {
+			s = reflect.Append(s, ev)
 		}
+		i++
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if v.Kind() == reflect.Slice {
+		v.Set(s)
+		return nil
+	}
+	for ; i < v.Len(); i++ {
+		v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+	}
+	return nil
+}
+
+// decodeD decodes data into d, preserving the order of its elements.
+// Embedded documents are decoded as D.
+func decodeD(data []byte, d *D, depth int) error {
+	*d = (*d)[:0]
+	iter := newReader(data)
+	for iter.Next() {
+		typ, ename, element := iter.Element()
+		x, err := decodeElement(typ, element, true, depth+1)
+		if err != nil {
+			return iter.annotate(err)
+		}
+		*d = append(*d, E{Key: string(trimlast(ename)), Value: x})
 	}
 	return iter.Err()
 }
 
-func decodeSlice(data []byte, v *[]interface{}) error {
-	iter := reader{bson: data[4 : len(data)-1]}
+// decodeSlice appends the elements of the BSON array data to v. If ordered
+// is true, embedded documents are decoded as D.
+func decodeSlice(data []byte, v *[]interface{}, ordered bool, depth int) error {
+	iter := newReader(data)
 	for iter.Next() {
 		typ, _, element := iter.Element()
-		switch typ {
-		case 0x01:
-			// double
-			bits := uint64(element[0]) | uint64(element[1])<<8 | uint64(element[2])<<16 | uint64(element[3])<<24 | uint64(element[4])<<32 | uint64(element[5]<<40) | uint64(element[6]<<48) | uint64(element[7]<<56)
-			*v = append(*v, bits)
+		x, err := decodeElement(typ, element, ordered, depth+1)
+		if err != nil {
+			return iter.annotate(err)
+		}
+		*v = append(*v, x)
+	}
+	return iter.Err()
+}
+
+// Unmarshaler is the interface implemented by types that can unmarshal
+// a BSON document of themselves. The input is a complete document,
+// including its length header and trailing 0x00.
+//
+// UnmarshalBSON must copy the BSON data if it wishes to retain the data
+// after returning.
+type Unmarshaler interface {
+	UnmarshalBSON([]byte) error
+}
+
+// ValueUnmarshaler is the interface implemented by types that can
+// unmarshal a single BSON element value of themselves. The input is the
+// element's type and its value as encoded in the document, including any
+// length prefix.
+//
+// UnmarshalBSONValue must copy the BSON data if it wishes to retain the
+// data after returning.
+type ValueUnmarshaler interface {
+	UnmarshalBSONValue(byte, []byte) error
+}
+
+var (
+	unmarshalerType      = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	valueUnmarshalerType = reflect.TypeOf((*ValueUnmarshaler)(nil)).Elem()
+	binaryType           = reflect.TypeOf(Binary{})
+	dType                = reflect.TypeOf(D{})
+	timeType             = reflect.TypeOf(time.Time{})
+)
+
+// unmarshalHook decodes value, the encoded value of a BSON element of type
+// typ, into v using its UnmarshalBSONValue or UnmarshalBSON method. It
+// reports whether v implemented either method. UnmarshalBSON is only
+// consulted for embedded documents.
+func unmarshalHook(v reflect.Value, typ byte, value []byte) (bool, error) {
+	switch {
+	case v.Kind() == reflect.Ptr:
+		t := v.Type()
+		if !t.Implements(valueUnmarshalerType) && !t.Implements(unmarshalerType) {
+			return false, nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+	case v.CanAddr():
+		v = v.Addr()
+	default:
+		return false, nil
+	}
+	switch u := v.Interface().(type) {
+	case ValueUnmarshaler:
+		return true, u.UnmarshalBSONValue(typ, value)
+	case Unmarshaler:
+		if typ != 0x03 {
+			return false, nil
+		}
+		return true, u.UnmarshalBSON(value)
+	}
+	return false, nil
+}
+
+// decodeElement returns the Go value of a BSON element of type typ. Documents
+// are returned as map[string]interface{}, or D if ordered is true, and arrays
+// as []interface{}. depth is the nesting of the element's value within the
+// outermost document.
+func decodeElement(typ byte, element []byte, ordered bool, depth int) (interface{}, error) {
+	if depth > MaxDepth && (typ == 0x03 || typ == 0x04 || typ == 0x0f) {
+		return nil, errMaxDepth()
+	}
+	switch typ {
+	case 0x01:
+		// double
+		return math.Float64frombits(uint64(readInt64(element))), nil
+	case 0x02:
+		// utf-8 string
+		return string(trimlast(element)), nil
+	case 0x03:
+		// BSON document
+		return decodeDocument(element, ordered, depth)
+	case 0x04:
+		// array
+		s := make([]interface{}, 0)
+		if err := decodeSlice(element, &s, ordered, depth); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case 0x05:
+		// binary data
+		b := Binary{Subtype: element[0], Data: element[1:]}
+		switch b.Subtype {
+		case 0x00:
+			return b.Data, nil
 		case 0x02:
-			// utf-8 string
-			*v = append(*v, string(trimlast(element)))
-		case 0x03:
-			// BSON document (map)
-			m := make(map[string]interface{})
-			vv := reflect.ValueOf(m)
-			if err := decodeMap(element, vv); err != nil {
-				return err
-			}
-			*v = append(*v, m)
-		case 0x04:
-			// array
-			s := make([]interface{}, 0)
-			if err := decodeSlice(element, &s); err != nil {
-				return err
+			// deprecated, strip the repeated length
+			b.Data = b.Data[4:]
+		}
+		return b, nil
+	case 0x06:
+		// undefined
+		return Undefined{}, nil
+	case 0x07:
+		// object id
+		var oid ObjectId
+		copy(oid[:], element)
+		return oid, nil
+	case 0x08:
+		// boolean
+		return element[0] == 1, nil
+	case 0x09:
+		// datetime
+		return Datetime(readInt64(element)), nil
+	case 0x0a:
+		// null
+		return nil, nil
+	case 0x0b:
+		// regex
+		i := bytes.IndexByte(element, 0)
+		return Regex{Pattern: string(element[:i]), Options: string(trimlast(element[i+1:]))}, nil
+	case 0x0c:
+		// DBPointer
+		n, _ := readInt32(element)
+		p := DBPointer{Ref: string(element[sizeofInt32 : sizeofInt32+n-1])}
+		copy(p.ID[:], element[sizeofInt32+n:])
+		return p, nil
+	case 0x0d:
+		// JavaScript code
+		return JavaScript(trimlast(element)), nil
+	case 0x0e:
+		// symbol
+		return Symbol(trimlast(element)), nil
+	case 0x0f:
+		// JavaScript code with scope
+		n, _ := readInt32(element[sizeofInt32:])
+		code := string(element[2*sizeofInt32 : 2*sizeofInt32+n-1])
+		scope, err := decodeDocument(element[2*sizeofInt32+n:], ordered, depth)
+		if err != nil {
+			if e, ok := err.(*SyntaxError); ok {
+				e.Offset += int64(2*sizeofInt32 + n)
 			}
-			*v = append(*v, s)
-		case 0x07:
-			// object id
-			var oid ObjectId
-			copy(oid[:], element)
-			*v = append(*v, oid)
-		case 0x08:
-			// boolean
-			b := element[0] == 1
-			*v = append(*v, b)
-		case 0x09:
-			// datetime
-			dt := Datetime(element[0]) | Datetime(element[1])<<8 | Datetime(element[2])<<16 | Datetime(element[3])<<24 | Datetime(element[4])<<32 | Datetime(element[5]<<40) | Datetime(element[6]<<48) | Datetime(element[7]<<56)
-			*v = append(*v, dt)
-		case 0x0a:
-			// null
-			*v = append(*v, nil)
-		case 0x10:
-			element := int32(element[0]) | int32(element[1])<<8 | int32(element[2])<<16 | int32(element[3])<<24
-			*v = append(*v, element)
-		case 0x11:
-			// timestamp
-			ts := Timestamp(element[0]) | Timestamp(element[1])<<8 | Timestamp(element[2])<<16 | Timestamp(element[3])<<24 | Timestamp(element[4])<<32 | Timestamp(element[5]<<40) | Timestamp(element[6]<<48) | Timestamp(element[7]<<56)
-			*v = append(*v, ts)
-		case 0x12:
-			element := int64(element[0]) | int64(element[1])<<8 | int64(element[2])<<16 | int64(element[3])<<24 | int64(element[4])<<32 | int64(element[5]<<40) | int64(element[6]<<48) | int64(element[7]<<56)
-			*v = append(*v, element)
-		default:
-			return fmt.Errorf("bson: unknown element type %x", typ)
+			return nil, err
 		}
+		return CodeWithScope{Code: code, Scope: scope}, nil
+	case 0x10:
+		// int32
+		n, _ := readInt32(element)
+		return int32(n), nil
+	case 0x11:
+		// timestamp
+		return Timestamp(readInt64(element)), nil
+	case 0x12:
+		// int64
+		return readInt64(element), nil
+	case 0x13:
+		// decimal128
+		return Decimal128{h: uint64(readInt64(element[8:])), l: uint64(readInt64(element))}, nil
+	case 0x7f:
+		// max key
+		return MaxKey{}, nil
+	case 0xff:
+		// min key
+		return MinKey{}, nil
+	default:
+		return nil, &InvalidBSONTypeError{Type: typ}
 	}
-	return iter.Err()
+}
+
+// decodeDocument decodes the BSON document data as a
+// map[string]interface{}, or a D if ordered is true.
+func decodeDocument(data []byte, ordered bool, depth int) (interface{}, error) {
+	if ordered {
+		var d D
+		if err := decodeD(data, &d, depth); err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+	m := make(map[string]interface{})
+	if err := decodeMap(data, reflect.ValueOf(m), depth); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// setValue stores x, the value of a BSON element of type typ, in v. Numeric
+// values are converted to the kind of v where that can be done without
+// overflow.
+func setValue(v reflect.Value, typ byte, x interface{}) error {
+	switch x := x.(type) {
+	case nil:
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	case int32:
+		return setInt(v, typ, int64(x))
+	case int64:
+		return setInt(v, typ, x)
+	case float64:
+		return setFloat(v, typ, x)
+	case []byte:
+		if v.Type() == binaryType {
+			v.Set(reflect.ValueOf(Binary{Data: x}))
+			return nil
+		}
+	case Binary:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(x.Data)
+			return nil
+		}
+	case Datetime:
+		if v.Type() == timeType {
+			v.Set(reflect.ValueOf(x.Time()))
+			return nil
+		}
+	}
+	xv := reflect.ValueOf(x)
+	switch {
+	case xv.Type().AssignableTo(v.Type()):
+		v.Set(xv)
+	case xv.Kind() == v.Kind() && xv.Type().ConvertibleTo(v.Type()):
+		// v is a named type with the same underlying type as x
+		v.Set(xv.Convert(v.Type()))
+	default:
+		return &UnmarshalTypeError{Value: typeName(typ), Type: v.Type()}
+	}
+	return nil
+}
+
+// setInt stores the integer n in v, which may be of any integer or
+// floating point kind.
+func setInt(v reflect.Value, typ byte, n int64) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(n) {
+			return &UnmarshalTypeError{Value: typeName(typ) + " " + strconv.FormatInt(n, 10), Type: v.Type()}
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return &UnmarshalTypeError{Value: typeName(typ) + " " + strconv.FormatInt(n, 10), Type: v.Type()}
+		}
+		v.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(n))
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return &UnmarshalTypeError{Value: typeName(typ), Type: v.Type()}
+		}
+		if typ == 0x10 {
+			v.Set(reflect.ValueOf(int32(n)))
+		} else {
+			v.Set(reflect.ValueOf(n))
+		}
+	default:
+		return &UnmarshalTypeError{Value: typeName(typ), Type: v.Type()}
+	}
+	return nil
+}
+
+// setFloat stores the floating point number f in v, which may be of any
+// floating point kind, or an integer kind if f has no fractional part.
+func setFloat(v reflect.Value, typ byte, f float64) error {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if v.OverflowFloat(f) {
+			return &UnmarshalTypeError{Value: typeName(typ) + " " + strconv.FormatFloat(f, 'g', -1, 64), Type: v.Type()}
+		}
+		v.SetFloat(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return &UnmarshalTypeError{Value: typeName(typ) + " " + strconv.FormatFloat(f, 'g', -1, 64), Type: v.Type()}
+		}
+		return setInt(v, typ, int64(f))
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return &UnmarshalTypeError{Value: typeName(typ), Type: v.Type()}
+		}
+		v.Set(reflect.ValueOf(f))
+	default:
+		return &UnmarshalTypeError{Value: typeName(typ), Type: v.Type()}
+	}
+	return nil
+}
+
+// typeName returns a short description of the BSON element type typ.
+func typeName(typ byte) string {
+	switch typ {
+	case 0x01:
+		return "double"
+	case 0x02:
+		return "string"
+	case 0x03:
+		return "document"
+	case 0x04:
+		return "array"
+	case 0x05:
+		return "binary"
+	case 0x06:
+		return "undefined"
+	case 0x07:
+		return "objectId"
+	case 0x08:
+		return "bool"
+	case 0x09:
+		return "datetime"
+	case 0x0a:
+		return "null"
+	case 0x0b:
+		return "regex"
+	case 0x0c:
+		return "dbPointer"
+	case 0x0d:
+		return "javascript"
+	case 0x0e:
+		return "symbol"
+	case 0x0f:
+		return "javascriptWithScope"
+	case 0x10:
+		return "int32"
+	case 0x11:
+		return "timestamp"
+	case 0x12:
+		return "int64"
+	case 0x13:
+		return "decimal128"
+	case 0x7f:
+		return "maxKey"
+	case 0xff:
+		return "minKey"
+	default:
+		return "element type " + strconv.FormatUint(uint64(typ), 16)
+	}
+}
+
+// An UnmarshalTypeError describes a BSON value that was
+// not appropriate for a value of a specific Go type.
+type UnmarshalTypeError struct {
+	Value string       // description of BSON value - "int32", "string", "int64 -1"
+	Type  reflect.Type // type of Go value it could not be assigned to
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return "bson: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+}
+
+// An InvalidUnmarshalError describes an invalid argument passed to Unmarshal.
+// (The argument to Unmarshal must be a non-nil pointer.)
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidUnmarshalError) Error() string {
+	if e.Type == nil {
+		return "bson: Unmarshal(nil)"
+	}
+	if e.Type.Kind() != reflect.Ptr {
+		return "bson: Unmarshal(non-pointer " + e.Type.String() + ")"
+	}
+	return "bson: Unmarshal(nil " + e.Type.String() + ")"
+}
+
+// An InvalidBSONTypeError describes an unhandled BSON document element type.
+type InvalidBSONTypeError struct {
+	Type byte
+}
+
+func (e *InvalidBSONTypeError) Error() string {
+	return "bson: unknown element type " + strconv.FormatUint(uint64(e.Type), 16)
+}
+
+// A SyntaxError describes corrupt BSON found while walking a document.
+type SyntaxError struct {
+	msg    string // description of error
+	Offset int64  // offset of the corrupt element from the start of the document
+	Path   string // dotted path of the corrupt element, if known
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("bson: %s at offset %d", e.msg, e.Offset)
+	}
+	return fmt.Sprintf("bson: %s at offset %d (%s)", e.msg, e.Offset, e.Path)
 }
 
 func trimlast(s []byte) []byte { return s[:len(s)-1] }
@@ -242,10 +596,24 @@ type reader struct {
 	// of the element is stored in ename[0]
 	element []byte
 
+	// the encoded value of element, including any length prefix.
+	value []byte
+
+	// offset of bson[0] from the start of the enclosing document.
+	off int
+
+	// offset of element from the start of the enclosing document.
+	voff int
+
 	// last error, if any
 	err error
 }
 
+// newReader returns a reader over the elements of the BSON document data.
+func newReader(data []byte) reader {
+	return reader{bson: data[4 : len(data)-1], off: 4}
+}
+
 // Next advances the reader to the next element in BSON document.
 // The element is available via the Element method. It returns false
 // when the end of the document is reached, or an error occurs.
@@ -259,12 +627,12 @@ func (r *reader) Next() bool {
 	case 1:
 		// error, there must be at least 2 bytes remaining to be
 		// valid BSON
-		r.err = errors.New("corrupt BSON, only 1 byte remains")
+		r.err = r.syntaxError(nil, "corrupt BSON, only 1 byte remains")
 		return false
 	}
 	i := bytes.IndexByte(r.bson[1:], 0)
 	if i < 0 {
-		r.err = errors.New("corrupt BSON ename")
+		r.err = r.syntaxError(nil, "corrupt BSON ename")
 		return false
 	}
 	i += 2
@@ -274,20 +642,20 @@ func (r *reader) Next() bool {
 	case 0x01:
 		// double
 		if len(rest) < 8 {
-			r.err = errors.New("corrupt BSON reading double")
+			r.err = r.syntaxError(ename, "corrupt BSON reading double")
 			return false
 		}
 		element, rest = rest[:8], rest[8:]
-	case 0x02:
-		// UTF-8 string
+	case 0x02, 0x0d, 0x0e:
+		// UTF-8 string, JavaScript code or symbol
 		if len(rest) < 5 {
-			r.err = errors.New("corrupt BSON reading utf8 string len")
+			r.err = r.syntaxError(ename, "corrupt BSON reading utf8 string len")
 			return false
 		}
 		var elen int
 		elen, rest = readInt32(rest)
-		if len(rest) < elen {
-			r.err = errors.New("corrupt BSON reading utf8 string")
+		if elen < 1 || len(rest) < elen {
+			r.err = r.syntaxError(ename, "corrupt BSON reading utf8 string")
 			return false
 		}
 		element = rest[:elen]
@@ -297,25 +665,53 @@ func (r *reader) Next() bool {
 		fallthrough
 	case 0x04:
 		// array (as BSON document)
+		if len(rest) < 5 {
+			r.err = r.syntaxError(ename, "corrupt BSON reading document len")
+			return false
+		}
 		var elen int
 		elen, _ = readInt32(rest)
-		if len(rest) < elen {
-			r.err = fmt.Errorf("corrupt document: want %x bytes, have %x", elen, len(rest))
+		if elen < 5 || len(rest) < elen {
+			r.err = r.syntaxError(ename, fmt.Sprintf("corrupt document: want %x bytes, have %x", elen, len(rest)))
 			return false
 		}
 		element = rest[:elen]
 		rest = rest[elen:]
+	case 0x05:
+		// binary data
+		if len(rest) < 5 {
+			r.err = r.syntaxError(ename, "corrupt BSON reading binary len")
+			return false
+		}
+		var elen int
+		elen, rest = readInt32(rest)
+		if elen < 0 || len(rest) < elen+1 {
+			r.err = r.syntaxError(ename, "corrupt BSON reading binary")
+			return false
+		}
+		if rest[0] == 0x02 {
+			// the deprecated binary subtype repeats the length of the data
+			if elen < 4 {
+				r.err = r.syntaxError(ename, "corrupt BSON reading deprecated binary")
+				return false
+			}
+			if n, _ := readInt32(rest[1:]); n != elen-4 {
+				r.err = r.syntaxError(ename, "corrupt BSON reading deprecated binary")
+				return false
+			}
+		}
+		element, rest = rest[:elen+1], rest[elen+1:]
 	case 0x07:
 		// object id
 		if len(rest) < 12 {
-			r.err = errors.New("corrupt BSON reading object id")
+			r.err = r.syntaxError(ename, "corrupt BSON reading object id")
 			return false
 		}
 		element, rest = rest[:12], rest[12:]
 	case 0x08:
 		// boolean
 		if len(rest) < 1 {
-			r.err = errors.New("corrupt BSON reading boolean")
+			r.err = r.syntaxError(ename, "corrupt BSON reading boolean")
 			return false
 		}
 		element, rest = rest[:1], rest[1:]
@@ -323,37 +719,66 @@ func (r *reader) Next() bool {
 		// UTC datetime
 		// int64
 		if len(rest) < 8 {
-			r.err = errors.New("corrupt BSON reading utc datetime")
+			r.err = r.syntaxError(ename, "corrupt BSON reading utc datetime")
 			return false
 		}
 		element, rest = rest[:8], rest[8:]
-	case 0x0a:
-		// null
+	case 0x06, 0x0a, 0x7f, 0xff:
+		// undefined, null, max key and min key have no value
 		element, rest = rest[:0], rest[0:]
 	case 0x0b:
 		// regex
 		if len(rest) < 2 {
 			// need at least two bytes for empty cstrings
-			r.err = errors.New("corrupt BSON reading regex")
+			r.err = r.syntaxError(ename, "corrupt BSON reading regex")
 			return false
 		}
 		i := bytes.IndexByte(rest, 0)
 		if i < 0 {
-			r.err = errors.New("corrupt BSON regex 1")
+			r.err = r.syntaxError(ename, "corrupt BSON regex 1")
 			return false
 		}
 		i++
-		j := bytes.IndexByte(rest[i+1:], 0)
+		j := bytes.IndexByte(rest[i:], 0)
 		if j < 0 {
-			r.err = errors.New("corrupt BSON regex 2")
+			r.err = r.syntaxError(ename, "corrupt BSON regex 2")
 			return false
 		}
 		j++
-		element, rest = rest[:i+j+1], rest[i+j+1:]
+		element, rest = rest[:i+j], rest[i+j:]
+	case 0x0c:
+		// DBPointer
+		if len(rest) < 5 {
+			r.err = r.syntaxError(ename, "corrupt BSON reading dbpointer len")
+			return false
+		}
+		elen, _ := readInt32(rest)
+		if elen < 1 || len(rest) < sizeofInt32+elen+12 {
+			r.err = r.syntaxError(ename, "corrupt BSON reading dbpointer")
+			return false
+		}
+		element, rest = rest[:sizeofInt32+elen+12], rest[sizeofInt32+elen+12:]
+	case 0x0f:
+		// JavaScript code with scope
+		if len(rest) < 14 {
+			r.err = r.syntaxError(ename, "corrupt BSON reading code with scope len")
+			return false
+		}
+		elen, _ := readInt32(rest)
+		slen, _ := readInt32(rest[4:])
+		if elen < 14 || len(rest) < elen || slen < 1 || 2*sizeofInt32+slen+5 > elen {
+			r.err = r.syntaxError(ename, "corrupt BSON reading code with scope")
+			return false
+		}
+		if dlen, _ := readInt32(rest[2*sizeofInt32+slen:]); 2*sizeofInt32+slen+dlen != elen {
+			r.err = r.syntaxError(ename, "corrupt BSON reading code with scope document")
+			return false
+		}
+		element, rest = rest[:elen], rest[elen:]
 	case 0x10:
 		// int32
 		if len(rest) < 4 {
-			r.err = errors.New("corrupt BSON reading int32")
+			r.err = r.syntaxError(ename, "corrupt BSON reading int32")
 			return false
 		}
 		element, rest = rest[:4], rest[4:]
@@ -363,18 +788,55 @@ func (r *reader) Next() bool {
 	case 0x12:
 		// int64
 		if len(rest) < 8 {
-			r.err = errors.New("corrupt BSON reading int64")
+			r.err = r.syntaxError(ename, "corrupt BSON reading int64")
 			return false
 		}
 		element, rest = rest[:8], rest[8:]
+	case 0x13:
+		// decimal128
+		if len(rest) < 16 {
+			r.err = r.syntaxError(ename, "corrupt BSON reading decimal128")
+			return false
+		}
+		element, rest = rest[:16], rest[16:]
 	default:
-		r.err = fmt.Errorf("bson: unknown element type %x", typ)
+		r.err = &InvalidBSONTypeError{Type: typ}
 		return false
 	}
+	r.value = r.bson[len(ename) : len(r.bson)-len(rest)]
+	r.voff = r.off + len(ename)
+	r.off += len(r.bson) - len(rest)
 	r.bson, r.ename, r.element = rest, ename, element
 	return true
 }
 
+// syntaxError returns a SyntaxError describing corruption found in the
+// element starting at the current offset. ename may be nil if the element
+// name could not be read.
+func (r *reader) syntaxError(ename []byte, msg string) error {
+	var path string
+	if len(ename) > 1 {
+		path = string(trimlast(ename[1:]))
+	}
+	return &SyntaxError{msg: msg, Offset: int64(r.off), Path: path}
+}
+
+// annotate adjusts a SyntaxError returned while decoding the value of the
+// current element so that its offset and path are relative to the
+// document being read by r. Other errors are returned unchanged.
+func (r *reader) annotate(err error) error {
+	if e, ok := err.(*SyntaxError); ok {
+		e.Offset += int64(r.voff)
+		name := string(trimlast(r.ename[1:]))
+		if e.Path == "" {
+			e.Path = name
+		} else {
+			e.Path = name + "." + e.Path
+		}
+	}
+	return err
+}
+
 // Err returns the first error that was encountered.
 func (r *reader) Err() error {
 	return r.err
@@ -385,6 +847,13 @@ func (r *reader) Element() (byte, []byte, []byte) {
 	return r.ename[0], r.ename[1:], r.element
 }
 
+// Value returns the encoded value of the most recent element read by a call
+// to Next. Unlike the element returned by Element, the value of a string
+// includes its length prefix.
+func (r *reader) Value() []byte {
+	return r.value
+}
+
 // readInt32 returns the value of the first 4 bytes of buf as a little endian
 // int32. The remaining bytes are return as a convenience.
 // If there is less than 4 bytes of data in buf, the function will panic.
@@ -393,6 +862,13 @@ func readInt32(buf []byte) (int, []byte) {
 	return v, buf[4:]
 }
 
+// readInt64 returns the value of the first 8 bytes of buf as a little endian
+// int64. If there is less than 8 bytes of data in buf, the function will panic.
+func readInt64(buf []byte) int64 {
+	return int64(buf[0]) | int64(buf[1])<<8 | int64(buf[2])<<16 | int64(buf[3])<<24 |
+		int64(buf[4])<<32 | int64(buf[5])<<40 | int64(buf[6])<<48 | int64(buf[7])<<56
+}
+
 // readCstring returns a []byte representing the cstring value, including
 // the trailing \0.
 func readCstring(buf []byte) ([]byte, []byte, error) {
@@ -2,6 +2,7 @@ package bson
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 )
@@ -130,6 +131,14 @@ var decodeTests = []struct {
 		ename:   cstring("array[string]"),
 		element: []byte("\x1f\x00\x00\x00\x020\x00\x06\x00\x00\x00hello\x00\x021\x00\x06\x00\x00\x00world\x00\x00"),
 	}},
+}, {
+	// test24.bson
+	bson: []byte("\x16\x00\x00\x00\x05binary\x00\x04\x00\x00\x00\x801234\x00"),
+	expected: []element{{
+		typ:     0x05,
+		ename:   cstring("binary"),
+		element: []byte("\x801234"),
+	}},
 }}
 
 func TestReader(t *testing.T) {
@@ -161,7 +170,7 @@ func TestDecodeMap(t *testing.T) {
 			continue
 		}
 		if !reflect.DeepEqual(tt.expected, got) {
-			t.Errorf("decode(%q): expected %q, got %q", tt.expected, got)
+			t.Errorf("decode(%q): expected %q, got %q", tt.bson, tt.expected, got)
 		}
 	}
 }
@@ -226,3 +235,121 @@ func TestReadCstring(t *testing.T) {
 		}
 	}
 }
+
+type userRecord struct {
+	UserID int          `bson:"user_id"`
+	Name   string       // matched case insensitively
+	Small  int32        `bson:"small"`
+	Ratio  float32      `bson:"ratio"`
+	Label  fmt.Stringer `bson:"label"`
+	Err    error        `bson:"err"`
+}
+
+var decodeStructTests = []struct {
+	in       interface{}
+	expected userRecord
+	err      error
+}{{
+	in: struct {
+		UserID int32 `bson:"user_id"`
+	}{7},
+	expected: userRecord{UserID: 7},
+}, {
+	in:       M{"name": "dave"},
+	expected: userRecord{Name: "dave"},
+}, {
+	in:       M{"small": int64(-3)},
+	expected: userRecord{Small: -3},
+}, {
+	in:  M{"small": int64(1 << 32)},
+	err: &UnmarshalTypeError{Value: "int64 4294967296", Type: reflect.TypeOf(int32(0))},
+}, {
+	in:       M{"ratio": 0.5},
+	expected: userRecord{Ratio: 0.5},
+}, {
+	in:  M{"user_id": "seven"},
+	err: &UnmarshalTypeError{Value: "string", Type: reflect.TypeOf(int(0))},
+}, {
+	in:       M{"unknown": true},
+	expected: userRecord{},
+}, {
+	in:  M{"label": int32(1)},
+	err: &UnmarshalTypeError{Value: "int32", Type: reflect.TypeOf((*fmt.Stringer)(nil)).Elem()},
+}, {
+	in:  M{"err": 1.5},
+	err: &UnmarshalTypeError{Value: "double", Type: reflect.TypeOf((*error)(nil)).Elem()},
+}}
+
+func TestDecodeStruct(t *testing.T) {
+	for _, tt := range decodeStructTests {
+		data, err := Marshal(tt.in)
+		if err != nil {
+			t.Fatalf("Marshal(%v): %v", tt.in, err)
+		}
+		var got userRecord
+		err = decode(data, &got)
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("decode(%v): expected err %v, got %v", tt.in, tt.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.expected, got) {
+			t.Errorf("decode(%v): expected %+v, got %+v", tt.in, tt.expected, got)
+		}
+	}
+}
+
+type label string
+
+func TestDecodeTyped(t *testing.T) {
+	data, err := Marshal(D{
+		{"tags", []interface{}{"a", "b"}},
+		{"scores", D{{"x", int64(1)}, {"y", int32(2)}}},
+		{"labels", D{{"k", "v"}}},
+		{"point", []interface{}{1.5, 2.5, 3.5}},
+		{"child", D{{"n", int32(1)}}},
+		{"children", []interface{}{D{{"n", int32(2)}}, nil}},
+		{"matrix", []interface{}{[]interface{}{int32(1)}, []interface{}{}}},
+	})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	type child struct {
+		N int `bson:"n"`
+	}
+	type typed struct {
+		Tags     []string         `bson:"tags"`
+		Scores   map[string]int64 `bson:"scores"`
+		Labels   map[label]label  `bson:"labels"`
+		Point    [2]float64       `bson:"point"`
+		Child    *child           `bson:"child"`
+		Children []*child         `bson:"children"`
+		Matrix   [][]int          `bson:"matrix"`
+	}
+	var got typed
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := typed{
+		Tags:     []string{"a", "b"},
+		Scores:   map[string]int64{"x": 1, "y": 2},
+		Labels:   map[label]label{"k": "v"},
+		Point:    [2]float64{1.5, 2.5},
+		Child:    &child{1},
+		Children: []*child{{2}, nil},
+		Matrix:   [][]int{{1}, {}},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Unmarshal: expected %+v, got %+v", want, got)
+	}
+
+	var bad struct {
+		Tags []int `bson:"tags"`
+	}
+	if err := Unmarshal(data, &bad); err == nil {
+		t.Errorf("Unmarshal: expected error decoding strings into []int")
+	}
+	var badKey map[int]interface{}
+	if err := Unmarshal(data, &badKey); err == nil {
+		t.Errorf("Unmarshal: expected error decoding into map[int]interface{}")
+	}
+}
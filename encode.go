@@ -5,34 +5,195 @@ import (
 	"math"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-// encode encodes v according to the rules of Marshal into a BSON document.
-func encode(v interface{}) ([]byte, error) {
+// encode encodes v according to the rules of Marshal into a BSON document,
+// appending it to w.
+func encode(w *writer, v interface{}) error {
 	rv := reflect.ValueOf(v)
-	if rv.IsNil() {
-		return nil, errors.New("bson: error calling MarshalJSON for type " + rv.Type().String() + ": was nil")
+	if !rv.IsValid() {
+		return errors.New("bson: Marshal(nil)")
 	}
-	if rv.Kind() == reflect.Ptr {
-		rv = rv.Elem()
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return errors.New("bson: Marshal(nil " + rv.Type().String() + ")")
+	}
+	_, err := w.writeDocument(rv)
+	return err
+}
+
+// Marshaler is the interface implemented by types that can marshal
+// themselves into a valid BSON document.
+type Marshaler interface {
+	MarshalBSON() ([]byte, error)
+}
+
+// ValueMarshaler is the interface implemented by types that can marshal
+// themselves into a single BSON element. MarshalBSONValue returns the
+// element's type and its value as encoded in a document, including any
+// length prefix.
+type ValueMarshaler interface {
+	MarshalBSONValue() (byte, []byte, error)
+}
+
+// checkDocument performs a shallow sanity check of the BSON document b
+// returned by a Marshaler.
+func checkDocument(b []byte) error {
+	if len(b) < 5 {
+		return ErrTooShort
+	}
+	if n, _ := readInt32(b); n != len(b) || b[len(b)-1] != 0 {
+		return errors.New("invalid BSON document")
+	}
+	return nil
+}
+
+// checkValue checks that value is exactly one well formed BSON value of
+// type typ, as held by a RawValue or returned by a ValueMarshaler.
+func checkValue(typ byte, value []byte) error {
+	if typ == 0 {
+		return errors.New("bson: invalid element type 0x00")
 	}
 	var w writer
-	switch rv.Kind() {
-	case reflect.Map:
-		_, err := w.writeMap(rv)
-		return w.bson, err
+	w.bson = append(w.bson, 0, 0, 0, 0)
+	w.writeType(typ)
+	w.writeCstring("")
+	w.writeBytes(value)
+	w.bson = append(w.bson, 0)
+	w.setInt32(0, int32(len(w.bson)))
+	if err := validateDocument(w.bson, false, 0); err != nil {
+		return err
+	}
+	iter := newReader(w.bson)
+	if iter.Next(); len(iter.Value()) != len(value) {
+		return errors.New("bson: malformed " + typeName(typ) + " value")
 	}
-	return nil, errors.New("bson: error calling MarshalJSON for type " + rv.Type().String() + ": unsupported")
+	return nil
+}
+
+// An UnsupportedTypeError is returned by Marshal when attempting
+// to encode an unsupported value type.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "bson: unsupported type: " + e.Type.String()
+}
+
+// An UnsupportedValueError is returned by Marshal when attempting
+// to encode a value that cannot be represented in BSON.
+type UnsupportedValueError struct {
+	Value reflect.Value
+	Str   string
+}
+
+func (e *UnsupportedValueError) Error() string {
+	return "bson: unsupported value: " + e.Str
+}
+
+// A MarshalerError is returned by Marshal when a type's MarshalBSON or
+// MarshalBSONValue method returns an error.
+type MarshalerError struct {
+	Type reflect.Type
+	Err  error
 }
 
+func (e *MarshalerError) Error() string {
+	return "bson: error calling MarshalBSON for type " + e.Type.String() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error returned by the marshaler.
+func (e *MarshalerError) Unwrap() error { return e.Err }
+
 // writer writes formatted BSON objects.
 type writer struct {
 	bson []byte
+
+	// depth is the number of documents being written and ptrs the number
+	// of pointers followed to reach the current value. Both are bounded by
+	// MaxDepth, which catches cycles.
+	depth, ptrs int
+
+	// forceInt64 encodes all integers as BSON int64.
+	forceInt64 bool
+}
+
+// enter records that the document or array v is about to be written,
+// returning an error if it would be nested more than MaxDepth deep, as
+// happens when v contains a cycle. Each successful call must be matched
+// by a call to leave.
+func (w *writer) enter(v reflect.Value) error {
+	if w.depth > MaxDepth {
+		return errCycle(v)
+	}
+	w.depth++
+	return nil
+}
+
+func (w *writer) leave() {
+	w.depth--
+}
+
+// errCycle returns the error for a value v nested too deeply to encode.
+func errCycle(v reflect.Value) error {
+	return &UnsupportedValueError{Value: v, Str: "exceeded max depth, possibly a cycle via " + v.Type().String()}
 }
 
-// writeMap encodes the contents of a map[string]interface{} as a BSON
+// writeDocument encodes v, which must be a map, a struct, a Marshaler or a
+// pointer to one of them, as a BSON document. An invalid v, such as that of
+// a nil interface, is written as an empty document.
+func (w *writer) writeDocument(v reflect.Value) (int, error) {
+	if !v.IsValid() {
+		w.bson = append(w.bson, 5, 0, 0, 0, 0)
+		return 5, nil
+	}
+	if m, ok := v.Interface().(Marshaler); ok && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		b, err := m.MarshalBSON()
+		if err == nil {
+			err = checkDocument(b)
+		}
+		if err != nil {
+			return 0, &MarshalerError{Type: v.Type(), Err: err}
+		}
+		return w.writeBytes(b), nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, errors.New("bson: Marshal(nil " + v.Type().String() + ")")
+		}
+		v = v.Elem()
+	}
+	switch d := v.Interface().(type) {
+	case D:
+		return w.writeD(d)
+	case Raw:
+		if err := checkDocument(d); err != nil {
+			return 0, err
+		}
+		return w.writeBytes(d), nil
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		return w.writeMap(v)
+	case reflect.Struct:
+		return w.writeStruct(v)
+	}
+	return 0, &UnsupportedTypeError{Type: v.Type()}
+}
+
+// writeMap encodes the contents of a map with string keys as a BSON
 // document.
 func (w *writer) writeMap(v reflect.Value) (int, error) {
+	if v.Type().Key().Kind() != reflect.String {
+		return 0, &UnsupportedTypeError{Type: v.Type()}
+	}
+	if err := w.enter(v); err != nil {
+		return 0, err
+	}
+	defer w.leave()
 	off := len(w.bson)                  // the location of our header
 	w.bson = append(w.bson, 0, 0, 0, 0) // document header
 	count := sizeofInt32 + 1            // header plus trailing 0x0
@@ -46,22 +207,105 @@ func (w *writer) writeMap(v reflect.Value) (int, error) {
 		count += n
 	}
 	w.bson = append(w.bson, 0) // document trailer
-	// update document header
-	w.bson[off] = byte(count)
-	w.bson[off+1] = byte(count >> 8)
-	w.bson[off+2] = byte(count >> 16)
-	w.bson[off+3] = byte(count >> 24)
+	w.setInt32(off, int32(count))
+	return count, nil
+}
+
+// writeD encodes the elements of d as a BSON document, in order.
+func (w *writer) writeD(d D) (int, error) {
+	if err := w.enter(reflect.ValueOf(d)); err != nil {
+		return 0, err
+	}
+	defer w.leave()
+	off := len(w.bson)                  // the location of our header
+	w.bson = append(w.bson, 0, 0, 0, 0) // document header
+	count := sizeofInt32 + 1            // header plus trailing 0x0
+	for _, e := range d {
+		n, err := w.writeValue(e.Key, reflect.ValueOf(e.Value))
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	w.bson = append(w.bson, 0) // document trailer
+	w.setInt32(off, int32(count))
+	return count, nil
+}
+
+// writeStruct encodes the exported fields of a struct as a BSON document,
+// in the order they are declared.
+func (w *writer) writeStruct(v reflect.Value) (int, error) {
+	if err := w.enter(v); err != nil {
+		return 0, err
+	}
+	defer w.leave()
+	off := len(w.bson)                  // the location of our header
+	w.bson = append(w.bson, 0, 0, 0, 0) // document header
+	count := sizeofInt32 + 1            // header plus trailing 0x0
+	for _, f := range cachedTypeFields(v.Type()) {
+		v := v.Field(f.index)
+		if f.omitEmpty && isEmptyValue(v) {
+			continue
+		}
+		n, err := w.writeValue(f.name, v)
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	w.bson = append(w.bson, 0) // document trailer
+	w.setInt32(off, int32(count))
 	return count, nil
 }
 
 func (w *writer) writeValue(ename string, v reflect.Value) (int, error) {
+	if strings.IndexByte(ename, 0) >= 0 {
+		return 0, errors.New("bson: element name " + strconv.Quote(ename) + " contains \\0")
+	}
 	var count int
-	if v.IsNil() {
-		count += w.writeType(0x0a)
-		count += w.writeCstring(ename)
-		return count, nil
+	if !v.IsValid() || v.Kind() == reflect.Interface {
+		if !v.IsValid() || v.IsNil() {
+			count += w.writeType(0x0a)
+			count += w.writeCstring(ename)
+			return count, nil
+		}
+		v = v.Elem()
+	}
+	if n, ok, err := w.writeMarshaler(ename, v); ok {
+		return n, err
 	}
 	switch vv := v.Interface().(type) {
+	case D:
+		count += w.writeType(0x03)
+		count += w.writeCstring(ename)
+		n, err := w.writeD(vv)
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	case Raw:
+		if vv == nil {
+			count += w.writeType(0x0a)
+			count += w.writeCstring(ename)
+			break
+		}
+		if err := checkDocument(vv); err != nil {
+			return 0, err
+		}
+		count += w.writeType(0x03)
+		count += w.writeCstring(ename)
+		count += w.writeBytes(vv)
+	case RawValue:
+		if err := checkValue(vv.Type, vv.Value); err != nil {
+			return 0, err
+		}
+		count += w.writeType(vv.Type)
+		count += w.writeCstring(ename)
+		count += w.writeBytes(vv.Value)
+	case Binary:
+		count += w.writeType(0x05)
+		count += w.writeCstring(ename)
+		count += w.writeBinary(vv.Subtype, vv.Data)
 	case ObjectId:
 		count += w.writeType(0x07)
 		count += w.writeCstring(ename)
@@ -70,38 +314,114 @@ func (w *writer) writeValue(ename string, v reflect.Value) (int, error) {
 		count += w.writeType(0x09)
 		count += w.writeCstring(ename)
 		count += w.writeInt64(int64(vv))
+	case time.Time:
+		count += w.writeType(0x09)
+		count += w.writeCstring(ename)
+		count += w.writeInt64(int64(NewDatetime(vv)))
 	case Timestamp:
 		count += w.writeType(0x11)
 		count += w.writeCstring(ename)
 		count += w.writeInt64(int64(vv))
+	case Regex:
+		re, err := NewRegex(vv.Pattern, vv.Options)
+		if err != nil {
+			return 0, err
+		}
+		count += w.writeType(0x0b)
+		count += w.writeCstring(ename)
+		count += w.writeCstring(re.Pattern)
+		count += w.writeCstring(re.Options)
+	case DBPointer:
+		count += w.writeType(0x0c)
+		count += w.writeCstring(ename)
+		count += w.writeString(vv.Ref)
+		count += w.writeBytes(vv.ID[:])
+	case JavaScript:
+		count += w.writeType(0x0d)
+		count += w.writeCstring(ename)
+		count += w.writeString(string(vv))
+	case Symbol:
+		count += w.writeType(0x0e)
+		count += w.writeCstring(ename)
+		count += w.writeString(string(vv))
+	case CodeWithScope:
+		count += w.writeType(0x0f)
+		count += w.writeCstring(ename)
+		off := len(w.bson)
+		n := w.writeInt32(0) // length of code and scope
+		n += w.writeString(vv.Code)
+		m, err := w.writeDocument(reflect.ValueOf(vv.Scope))
+		if err != nil {
+			return 0, err
+		}
+		n += m
+		w.setInt32(off, int32(n))
+		count += n
+	case Undefined:
+		count += w.writeType(0x06)
+		count += w.writeCstring(ename)
+	case MaxKey:
+		count += w.writeType(0x7f)
+		count += w.writeCstring(ename)
+	case MinKey:
+		count += w.writeType(0xff)
+		count += w.writeCstring(ename)
+	case Decimal128:
+		count += w.writeType(0x13)
+		count += w.writeCstring(ename)
+		count += w.writeInt64(int64(vv.l))
+		count += w.writeInt64(int64(vv.h))
 	default:
-		switch v := v.Elem(); v.Kind() {
-		case reflect.Float64:
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
 			count += w.writeType(0x01)
 			count += w.writeCstring(ename)
 			count += w.writeFloat64(v.Float())
 		case reflect.String:
 			count += w.writeType(0x02)
 			count += w.writeCstring(ename)
-			s := v.String()
-			sz := len(s) + 1
-			count += w.writeInt32(int32(sz))
-			w.bson = append(w.bson, s...)
-			w.bson = append(w.bson, 0)
-			count += sz
+			count += w.writeString(v.String())
 		case reflect.Bool:
 			count += w.writeType(0x08)
 			count += w.writeCstring(ename)
 			count += w.writeBool(v.Bool())
-		case reflect.Int32:
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n := v.Int()
+			if w.forceInt64 || v.Kind() == reflect.Int64 || n < math.MinInt32 || n > math.MaxInt32 {
+				count += w.writeType(0x12)
+				count += w.writeCstring(ename)
+				count += w.writeInt64(n)
+				break
+			}
 			count += w.writeType(0x10)
 			count += w.writeCstring(ename)
-			count += w.writeInt32(int32(v.Int()))
-		case reflect.Int64:
+			count += w.writeInt32(int32(n))
+		case reflect.Uint8, reflect.Uint16:
+			if w.forceInt64 {
+				count += w.writeType(0x12)
+				count += w.writeCstring(ename)
+				count += w.writeInt64(int64(v.Uint()))
+				break
+			}
+			count += w.writeType(0x10)
+			count += w.writeCstring(ename)
+			count += w.writeInt32(int32(v.Uint()))
+		case reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n := v.Uint()
+			if n > math.MaxInt64 {
+				return 0, &UnsupportedValueError{Value: v, Str: strconv.FormatUint(n, 10) + " overflows int64"}
+			}
 			count += w.writeType(0x12)
 			count += w.writeCstring(ename)
-			count += w.writeInt64(int64(v.Int()))
+			count += w.writeInt64(int64(n))
 		case reflect.Slice:
+			if v.Type().Elem().Kind() == reflect.Uint8 {
+				// byte slices encoded as generic binary data
+				count += w.writeType(0x05)
+				count += w.writeCstring(ename)
+				count += w.writeBinary(0x00, v.Bytes())
+				break
+			}
 			// slices encoded as arrays
 			count += w.writeType(0x04)
 			count += w.writeCstring(ename)
@@ -119,14 +439,88 @@ func (w *writer) writeValue(ename string, v reflect.Value) (int, error) {
 				return 0, err
 			}
 			count += n
+		case reflect.Struct:
+			// structs encoded as documents
+			count += w.writeType(0x03)
+			count += w.writeCstring(ename)
+			n, err := w.writeStruct(v)
+			if err != nil {
+				return 0, err
+			}
+			count += n
+		case reflect.Array:
+			// fixed size arrays encoded as arrays
+			count += w.writeType(0x04)
+			count += w.writeCstring(ename)
+			n, err := w.writeSlice(v)
+			if err != nil {
+				return 0, err
+			}
+			count += n
+		case reflect.Ptr:
+			if v.IsNil() {
+				count += w.writeType(0x0a)
+				count += w.writeCstring(ename)
+				break
+			}
+			if w.ptrs > MaxDepth {
+				return 0, errCycle(v)
+			}
+			w.ptrs++
+			defer func() { w.ptrs-- }()
+			return w.writeValue(ename, v.Elem())
 		default:
-			return 0, errors.New("bson: unsupported type: " + v.Type().String())
+			return 0, &UnsupportedTypeError{Type: v.Type()}
 		}
 	}
 	return count, nil
 }
 
+// writeMarshaler writes v using its MarshalBSONValue or MarshalBSON method.
+// It reports whether v implemented either method.
+func (w *writer) writeMarshaler(ename string, v reflect.Value) (int, bool, error) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return 0, false, nil
+	}
+	i := v.Interface()
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		i = v.Addr().Interface()
+	}
+	var count int
+	switch m := i.(type) {
+	case ValueMarshaler:
+		typ, b, err := m.MarshalBSONValue()
+		if err == nil {
+			err = checkValue(typ, b)
+		}
+		if err != nil {
+			return 0, true, &MarshalerError{Type: v.Type(), Err: err}
+		}
+		count += w.writeType(typ)
+		count += w.writeCstring(ename)
+		count += w.writeBytes(b)
+	case Marshaler:
+		b, err := m.MarshalBSON()
+		if err == nil {
+			err = checkDocument(b)
+		}
+		if err != nil {
+			return 0, true, &MarshalerError{Type: v.Type(), Err: err}
+		}
+		count += w.writeType(0x03)
+		count += w.writeCstring(ename)
+		count += w.writeBytes(b)
+	default:
+		return 0, false, nil
+	}
+	return count, true, nil
+}
+
 func (w *writer) writeSlice(v reflect.Value) (int, error) {
+	if err := w.enter(v); err != nil {
+		return 0, err
+	}
+	defer w.leave()
 	off := len(w.bson)                  // the location of our header
 	w.bson = append(w.bson, 0, 0, 0, 0) // document header
 	count := sizeofInt32 + 1            // header plus trailing 0x0
@@ -139,11 +533,7 @@ func (w *writer) writeSlice(v reflect.Value) (int, error) {
 		count += n
 	}
 	w.bson = append(w.bson, 0) // document trailer
-	// update document header
-	w.bson[off] = byte(count)
-	w.bson[off+1] = byte(count >> 8)
-	w.bson[off+2] = byte(count >> 16)
-	w.bson[off+3] = byte(count >> 24)
+	w.setInt32(off, int32(count))
 	return count, nil
 }
 
@@ -166,6 +556,29 @@ func (w *writer) writeBytes(b []byte) int {
 	return len(b)
 }
 
+func (w *writer) writeBinary(subtype byte, data []byte) int {
+	var count int
+	if subtype == 0x02 {
+		// the deprecated binary subtype repeats the length of the data
+		count += w.writeInt32(int32(len(data) + sizeofInt32))
+		count += w.writeBytes([]byte{subtype})
+		count += w.writeInt32(int32(len(data)))
+	} else {
+		count += w.writeInt32(int32(len(data)))
+		count += w.writeBytes([]byte{subtype})
+	}
+	count += w.writeBytes(data)
+	return count
+}
+
+// writeString writes s as a BSON string, preceded by its length.
+func (w *writer) writeString(s string) int {
+	count := w.writeInt32(int32(len(s) + 1))
+	w.bson = append(w.bson, s...)
+	w.bson = append(w.bson, 0)
+	return count + len(s) + 1
+}
+
 func (w *writer) writeCstring(s string) int {
 	w.bson = append(w.bson, s...)
 	w.bson = append(w.bson, 0)
@@ -177,6 +590,15 @@ func (w *writer) writeInt32(v int32) int {
 	return sizeofInt32
 }
 
+// setInt32 overwrites the four bytes at off with v, used to fill in
+// a document header once its length is known.
+func (w *writer) setInt32(off int, v int32) {
+	w.bson[off] = byte(v)
+	w.bson[off+1] = byte(v >> 8)
+	w.bson[off+2] = byte(v >> 16)
+	w.bson[off+3] = byte(v >> 24)
+}
+
 func (w *writer) writeInt64(v int64) int {
 	w.bson = append(w.bson, byte(v), byte(v>>8), byte(v>>16), byte(v>>24),
 		byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56))
@@ -189,3 +611,104 @@ func (w *writer) writeFloat64(f float64) int {
 		byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56))
 	return sizeofInt64
 }
+
+// field represents a single exported struct field and the BSON element
+// name it is encoded as.
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// typeFields returns the fields that should be encoded for the struct
+// type t, in declaration order.
+func typeFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+		tag := sf.Tag.Get("bson")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{
+			name:      name,
+			index:     i,
+			omitEmpty: hasOption(opts, "omitempty"),
+		})
+	}
+	return fields
+}
+
+var fieldCache struct {
+	sync.RWMutex
+	m map[reflect.Type][]field
+}
+
+// cachedTypeFields is like typeFields but uses a cache to avoid repeated work.
+func cachedTypeFields(t reflect.Type) []field {
+	fieldCache.RLock()
+	f, ok := fieldCache.m[t]
+	fieldCache.RUnlock()
+	if ok {
+		return f
+	}
+	f = typeFields(t)
+	fieldCache.Lock()
+	if fieldCache.m == nil {
+		fieldCache.m = make(map[reflect.Type][]field)
+	}
+	fieldCache.m[t] = f
+	fieldCache.Unlock()
+	return f
+}
+
+// parseTag splits a struct field's bson tag into its name and
+// comma-separated options.
+func parseTag(tag string) (string, string) {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
+
+// hasOption reports whether the comma-separated list opts contains name.
+func hasOption(opts, name string) bool {
+	for opts != "" {
+		var opt string
+		if i := strings.Index(opts, ","); i >= 0 {
+			opt, opts = opts[:i], opts[i+1:]
+		} else {
+			opt, opts = opts, ""
+		}
+		if opt == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
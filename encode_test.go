@@ -1,6 +1,8 @@
 package bson
 
 import (
+	"bytes"
+	"math"
 	"reflect"
 	"testing"
 )
@@ -62,3 +64,142 @@ func TestWriterGrow(t *testing.T) {
 	checklen(w2.bson, 5)
 	checkcap(w2.bson, 5)
 }
+
+var encodeNumberTests = []struct {
+	v          interface{}
+	forceInt64 bool
+	typ        byte
+	err        bool
+}{
+	{v: int8(-1), typ: 0x10},
+	{v: int16(1), typ: 0x10},
+	{v: int32(1), typ: 0x10},
+	{v: int64(1), typ: 0x12},
+	{v: int(1), typ: 0x10},
+	{v: int(math.MaxInt32 + 1), typ: 0x12},
+	{v: int(math.MinInt32 - 1), typ: 0x12},
+	{v: uint8(1), typ: 0x10},
+	{v: uint16(1), typ: 0x10},
+	{v: uint32(math.MaxUint32), typ: 0x12},
+	{v: uint(1), typ: 0x12},
+	{v: uint64(math.MaxInt64), typ: 0x12},
+	{v: uint64(math.MaxInt64 + 1), err: true},
+	{v: float32(1.5), typ: 0x01},
+	{v: float64(1.5), typ: 0x01},
+	{v: int8(1), forceInt64: true, typ: 0x12},
+	{v: int(1), forceInt64: true, typ: 0x12},
+	{v: uint16(1), forceInt64: true, typ: 0x12},
+}
+
+func TestWriteNumber(t *testing.T) {
+	for _, tt := range encodeNumberTests {
+		w := writer{forceInt64: tt.forceInt64}
+		_, err := w.writeValue("n", reflect.ValueOf(tt.v))
+		if tt.err {
+			if _, ok := err.(*UnsupportedValueError); !ok {
+				t.Errorf("writeValue(%T(%v)): expected UnsupportedValueError, got %v", tt.v, tt.v, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("writeValue(%T(%v)): %v", tt.v, tt.v, err)
+			continue
+		}
+		if w.bson[0] != tt.typ {
+			t.Errorf("writeValue(%T(%v)): expected type %#x, got %#x", tt.v, tt.v, tt.typ, w.bson[0])
+			continue
+		}
+		// decode it again and compare the value
+		v := reflect.New(reflect.TypeOf(tt.v))
+		x, _ := decodeElement(w.bson[0], w.bson[3:], false, 0)
+		if err := setValue(v.Elem(), w.bson[0], x); err != nil || v.Elem().Interface() != tt.v {
+			t.Errorf("writeValue(%T(%v)): round trip got %v %v", tt.v, tt.v, v.Elem(), err)
+		}
+	}
+}
+
+func TestEncoderForceInt64(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetForceInt64(true)
+	if err := e.Encode(struct{ N int }{1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := Raw(buf.Bytes()).Lookup("N"); got.Type != 0x12 {
+		t.Errorf("Encode: expected int64, got %v", got)
+	}
+}
+
+func TestWriteNested(t *testing.T) {
+	type inner struct {
+		N int32 `bson:"n"`
+	}
+	s := "str"
+	ps := &s
+	v := struct {
+		Nil    *string     `bson:"nil"`
+		Str    *string     `bson:"str"`
+		PPStr  **string    `bson:"ppstr"`
+		Arr    [2]int32    `bson:"arr"`
+		Inner  inner       `bson:"inner"`
+		PInner *inner      `bson:"pinner"`
+		Iface  interface{} `bson:"iface"`
+	}{
+		Str:    ps,
+		PPStr:  &ps,
+		Arr:    [2]int32{1, 2},
+		Inner:  inner{3},
+		PInner: &inner{4},
+		Iface:  &inner{5},
+	}
+	data, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want, err := Marshal(D{
+		{"nil", nil},
+		{"str", "str"},
+		{"ppstr", "str"},
+		{"arr", []interface{}{int32(1), int32(2)}},
+		{"inner", D{{"n", int32(3)}}},
+		{"pinner", D{{"n", int32(4)}}},
+		{"iface", D{{"n", int32(5)}}},
+	})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !reflect.DeepEqual(want, data) {
+		t.Errorf("Marshal: expected %q, got %q", want, data)
+	}
+}
+
+type cyclic struct{ Next *cyclic }
+
+type selfPtr *selfPtr
+
+func TestWriteCycle(t *testing.T) {
+	n := &cyclic{}
+	n.Next = n
+	m := M{}
+	m["m"] = m
+	var p selfPtr
+	p = &p
+	for _, v := range []interface{}{n, m, D{{"p", p}}} {
+		_, err := Marshal(v)
+		if _, ok := err.(*UnsupportedValueError); !ok {
+			t.Errorf("Marshal(%T): expected *UnsupportedValueError, got %v", v, err)
+		}
+	}
+
+	// nesting is bounded as for Unmarshal
+	var d interface{} = D{}
+	for i := 0; i < MaxDepth; i++ {
+		d = D{{"a", d}}
+	}
+	if _, err := Marshal(d); err != nil {
+		t.Errorf("Marshal: depth %d: %v", MaxDepth, err)
+	}
+	if _, err := Marshal(D{{"a", d}}); err == nil {
+		t.Errorf("Marshal: depth %d: expected error", MaxDepth+1)
+	}
+}
@@ -0,0 +1,866 @@
+package bson
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MarshalExtJSON returns the MongoDB Extended JSON v2 representation of the
+// BSON encoding of v. v may be anything Marshal accepts, including a Raw
+// holding an existing document.
+//
+// If canonical is true the output preserves the type of every element,
+// wrapping numbers as $numberInt, $numberLong and $numberDouble and
+// datetimes as $numberLong milliseconds. Otherwise the relaxed form is
+// used, which writes int32, int64 and finite double values as JSON
+// numbers, and datetimes between the years 1970 and 9999 as ISO-8601
+// strings. Types which JSON has no equivalent for, such as ObjectId and
+// Binary, are wrapped in both forms.
+func MarshalExtJSON(v interface{}, canonical bool) ([]byte, error) {
+	data, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateDocument(data, false, 0); err != nil {
+		return nil, err
+	}
+	return appendExtJSONDocument(nil, data, false, canonical), nil
+}
+
+// MarshalExtJSONValue returns the Extended JSON representation of the
+// single BSON value v, as MarshalExtJSON would write it as the value of a
+// document's element. It returns an error if v.Value does not hold
+// exactly one well formed value of type v.Type.
+func MarshalExtJSONValue(v RawValue, canonical bool) ([]byte, error) {
+	// Marshal checks that v is a single well formed value
+	data, err := Marshal(D{{"", v}})
+	if err != nil {
+		return nil, err
+	}
+	iter := newReader(data)
+	iter.Next()
+	typ, _, element := iter.Element()
+	return appendExtJSONValue(nil, typ, element, canonical), nil
+}
+
+// appendExtJSONDocument appends the Extended JSON representation of the
+// valid BSON document data to b, as a JSON array if array is true.
+func appendExtJSONDocument(b []byte, data []byte, array, canonical bool) []byte {
+	open, close := byte('{'), byte('}')
+	if array {
+		open, close = '[', ']'
+	}
+	b = append(b, open)
+	iter := newReader(data)
+	for i := 0; iter.Next(); i++ {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		typ, ename, element := iter.Element()
+		if !array {
+			b = appendJSONString(b, string(trimlast(ename)))
+			b = append(b, ':')
+		}
+		b = appendExtJSONValue(b, typ, element, canonical)
+	}
+	return append(b, close)
+}
+
+// appendExtJSONValue appends the Extended JSON representation of the BSON
+// element of type typ to b.
+func appendExtJSONValue(b []byte, typ byte, element []byte, canonical bool) []byte {
+	switch typ {
+	case 0x01:
+		f := math.Float64frombits(uint64(readInt64(element)))
+		if !canonical && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return append(b, formatExtJSONDouble(f)...)
+		}
+		return appendExtJSONWrapper(b, "$numberDouble", formatExtJSONDouble(f))
+	case 0x02:
+		return appendJSONString(b, string(trimlast(element)))
+	case 0x03:
+		return appendExtJSONDocument(b, element, false, canonical)
+	case 0x04:
+		return appendExtJSONDocument(b, element, true, canonical)
+	case 0x05:
+		subtype, data := element[0], element[1:]
+		if subtype == 0x02 {
+			data = data[4:]
+		}
+		b = append(b, `{"$binary":{"base64":`...)
+		b = appendJSONString(b, base64.StdEncoding.EncodeToString(data))
+		b = append(b, `,"subType":`...)
+		b = appendJSONString(b, hex.EncodeToString([]byte{subtype}))
+		return append(b, "}}"...)
+	case 0x06:
+		return append(b, `{"$undefined":true}`...)
+	case 0x07:
+		return appendExtJSONWrapper(b, "$oid", hex.EncodeToString(element))
+	case 0x08:
+		return strconv.AppendBool(b, element[0] == 1)
+	case 0x09:
+		ms := readInt64(element)
+		t := Datetime(ms).Time()
+		if !canonical && t.Year() >= 1970 && t.Year() <= 9999 {
+			layout := "2006-01-02T15:04:05.000Z"
+			if ms%1e3 == 0 {
+				layout = "2006-01-02T15:04:05Z"
+			}
+			return appendExtJSONWrapper(b, "$date", t.Format(layout))
+		}
+		b = append(b, `{"$date":`...)
+		b = appendExtJSONWrapper(b, "$numberLong", strconv.FormatInt(ms, 10))
+		return append(b, '}')
+	case 0x0a:
+		return append(b, "null"...)
+	case 0x0b:
+		i := bytes.IndexByte(element, 0)
+		options := []byte(string(trimlast(element[i+1:])))
+		sort.Slice(options, func(i, j int) bool { return options[i] < options[j] })
+		b = append(b, `{"$regularExpression":{"pattern":`...)
+		b = appendJSONString(b, string(element[:i]))
+		b = append(b, `,"options":`...)
+		b = appendJSONString(b, string(options))
+		return append(b, "}}"...)
+	case 0x0c:
+		n, _ := readInt32(element)
+		b = append(b, `{"$dbPointer":{"$ref":`...)
+		b = appendJSONString(b, string(element[sizeofInt32:sizeofInt32+n-1]))
+		b = append(b, `,"$id":`...)
+		b = appendExtJSONWrapper(b, "$oid", hex.EncodeToString(element[sizeofInt32+n:]))
+		return append(b, "}}"...)
+	case 0x0d:
+		return appendExtJSONWrapper(b, "$code", string(trimlast(element)))
+	case 0x0e:
+		return appendExtJSONWrapper(b, "$symbol", string(trimlast(element)))
+	case 0x0f:
+		n, _ := readInt32(element[sizeofInt32:])
+		b = append(b, `{"$code":`...)
+		b = appendJSONString(b, string(element[2*sizeofInt32:2*sizeofInt32+n-1]))
+		b = append(b, `,"$scope":`...)
+		b = appendExtJSONDocument(b, element[2*sizeofInt32+n:], false, canonical)
+		return append(b, '}')
+	case 0x10:
+		n, _ := readInt32(element)
+		if !canonical {
+			return strconv.AppendInt(b, int64(int32(n)), 10)
+		}
+		return appendExtJSONWrapper(b, "$numberInt", strconv.Itoa(int(int32(n))))
+	case 0x11:
+		ts := Timestamp(readInt64(element))
+		b = append(b, `{"$timestamp":{"t":`...)
+		b = strconv.AppendUint(b, uint64(ts.T()), 10)
+		b = append(b, `,"i":`...)
+		b = strconv.AppendUint(b, uint64(ts.I()), 10)
+		return append(b, "}}"...)
+	case 0x12:
+		n := readInt64(element)
+		if !canonical {
+			return strconv.AppendInt(b, n, 10)
+		}
+		return appendExtJSONWrapper(b, "$numberLong", strconv.FormatInt(n, 10))
+	case 0x13:
+		d := Decimal128{h: uint64(readInt64(element[8:])), l: uint64(readInt64(element))}
+		return appendExtJSONWrapper(b, "$numberDecimal", d.String())
+	case 0x7f:
+		return append(b, `{"$maxKey":1}`...)
+	case 0xff:
+		return append(b, `{"$minKey":1}`...)
+	default:
+		// unreachable, the reader rejects unknown types
+		panic("bson: unknown element type " + strconv.Itoa(int(typ)))
+	}
+}
+
+// appendExtJSONWrapper appends the object {"key":"value"} to b.
+func appendExtJSONWrapper(b []byte, key, value string) []byte {
+	b = append(b, '{')
+	b = appendJSONString(b, key)
+	b = append(b, ':')
+	b = appendJSONString(b, value)
+	return append(b, '}')
+}
+
+// formatExtJSONDouble formats f as Extended JSON does, with a decimal
+// point or exponent so it is not mistaken for an integer, for example
+// "1.0", "-0.0", "1.5E+20" or "Infinity".
+func formatExtJSONDouble(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	s := strconv.FormatFloat(f, 'G', -1, 64)
+	mant, exp := s, ""
+	if i := strings.IndexByte(s, 'E'); i >= 0 {
+		mant, exp = s[:i], s[i:]
+		// strip the leading zero Go adds to one digit exponents
+		if len(exp) == 4 && exp[2] == '0' {
+			exp = exp[:2] + exp[3:]
+		}
+	}
+	if !strings.Contains(mant, ".") {
+		mant += ".0"
+	}
+	return mant + exp
+}
+
+// appendJSONString appends s to b as a quoted JSON string. Invalid UTF-8
+// is replaced by U+FFFD.
+func appendJSONString(b []byte, s string) []byte {
+	const hexDigits = "0123456789abcdef"
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c == '\n':
+				b = append(b, '\\', 'n')
+			case c == '\r':
+				b = append(b, '\\', 'r')
+			case c == '\t':
+				b = append(b, '\\', 't')
+			case c < 0x20:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				b = append(b, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, "\ufffd"...)
+		} else {
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(b, '"')
+}
+
+// UnmarshalExtJSON parses the MongoDB Extended JSON document data, in
+// either canonical or relaxed form, and returns its BSON encoding. Keys
+// keep the order they have in data.
+//
+// Objects whose keys form one of the Extended JSON type wrappers, such as
+// {"$oid": "..."} or {"$date": "..."}, become the corresponding BSON
+// element, as do the legacy forms {"$binary": "...", "$type": "..."},
+// {"$regex": "...", "$options": "..."} and {"$date": <number>}. Plain JSON
+// numbers become int32 or int64 if they are integers that fit, and double
+// otherwise. Malformed input is reported as an *ExtJSONSyntaxError.
+func UnmarshalExtJSON(data []byte) ([]byte, error) {
+	return unmarshalJSON(extJSONParser{data: data})
+}
+
+// unmarshalJSON returns the BSON encoding of the JSON object p.data.
+func unmarshalJSON(p extJSONParser) ([]byte, error) {
+	data := p.data
+	p.skipSpace()
+	if p.off == len(data) || data[p.off] != '{' {
+		return nil, p.syntaxError(p.off, "expected JSON object")
+	}
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.off < len(data) {
+		return nil, p.syntaxError(p.off, "unexpected "+strconv.QuoteRune(rune(data[p.off]))+" after top-level object")
+	}
+	doc, err := p.convert(v)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(doc)
+}
+
+// An ExtJSONSyntaxError describes malformed Extended JSON. Line and Column
+// count from 1; Column counts bytes.
+type ExtJSONSyntaxError struct {
+	msg    string // description of error
+	Offset int64  // offset of the error from the start of the input
+	Line   int
+	Column int
+}
+
+func (e *ExtJSONSyntaxError) Error() string {
+	return "bson: " + e.msg + " at line " + strconv.Itoa(e.Line) + ", column " + strconv.Itoa(e.Column)
+}
+
+// extJSONValue is a parsed JSON value. Objects keep their members in order.
+type extJSONValue struct {
+	kind    byte // one of {, [, ", 0 (number), t, f or n
+	s       string
+	members []extJSONMember
+	elems   []*extJSONValue
+	off     int // offset of the value in the input
+}
+
+type extJSONMember struct {
+	key   string
+	off   int // offset of the key in the input
+	value *extJSONValue
+}
+
+// lookup returns the value of the member key of the object v, or nil.
+func (v *extJSONValue) lookup(key string) *extJSONValue {
+	for _, m := range v.members {
+		if m.key == key {
+			return m.value
+		}
+	}
+	return nil
+}
+
+// extJSONParser is a recursive descent JSON parser.
+type extJSONParser struct {
+	data  []byte
+	off   int
+	depth int
+
+	// plain disables the recognition of type wrappers.
+	plain bool
+}
+
+// maxExtJSONDepth bounds the nesting of parsed documents.
+const maxExtJSONDepth = 1000
+
+func (p *extJSONParser) syntaxError(off int, msg string) error {
+	line, col := 1, 1
+	for _, c := range p.data[:off] {
+		col++
+		if c == '\n' {
+			line, col = line+1, 1
+		}
+	}
+	return &ExtJSONSyntaxError{msg: msg, Offset: int64(off), Line: line, Column: col}
+}
+
+func (p *extJSONParser) skipSpace() {
+	for p.off < len(p.data) {
+		switch p.data[p.off] {
+		case ' ', '\t', '\r', '\n':
+			p.off++
+		default:
+			return
+		}
+	}
+}
+
+// expect skips whitespace and consumes c.
+func (p *extJSONParser) expect(c byte) error {
+	p.skipSpace()
+	if p.off == len(p.data) {
+		return p.syntaxError(p.off, "unexpected end of input, expected "+strconv.QuoteRune(rune(c)))
+	}
+	if p.data[p.off] != c {
+		return p.syntaxError(p.off, "unexpected "+strconv.QuoteRune(rune(p.data[p.off]))+", expected "+strconv.QuoteRune(rune(c)))
+	}
+	p.off++
+	return nil
+}
+
+func (p *extJSONParser) parseValue() (*extJSONValue, error) {
+	p.skipSpace()
+	if p.off == len(p.data) {
+		return nil, p.syntaxError(p.off, "unexpected end of input")
+	}
+	v := &extJSONValue{kind: p.data[p.off], off: p.off}
+	switch v.kind {
+	case '{', '[':
+		if p.depth++; p.depth > maxExtJSONDepth {
+			return nil, p.syntaxError(p.off, "exceeded max depth")
+		}
+		defer func() { p.depth-- }()
+		p.off++
+		close := byte('}')
+		if v.kind == '[' {
+			close = ']'
+		}
+		p.skipSpace()
+		if p.off < len(p.data) && p.data[p.off] == close {
+			p.off++
+			return v, nil
+		}
+		for {
+			if v.kind == '{' {
+				p.skipSpace()
+				if p.off == len(p.data) || p.data[p.off] != '"' {
+					return nil, p.syntaxError(p.off, "expected object key")
+				}
+				koff := p.off
+				key, err := p.parseString()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(':'); err != nil {
+					return nil, err
+				}
+				elem, err := p.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				v.members = append(v.members, extJSONMember{key: key, off: koff, value: elem})
+			} else {
+				elem, err := p.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				v.elems = append(v.elems, elem)
+			}
+			p.skipSpace()
+			if p.off < len(p.data) && p.data[p.off] == ',' {
+				p.off++
+				continue
+			}
+			if err := p.expect(close); err != nil {
+				return nil, err
+			}
+			return v, nil
+		}
+	case '"':
+		s, err := p.parseString()
+		v.s = s
+		return v, err
+	case 't', 'f', 'n':
+		for _, lit := range []string{"true", "false", "null"} {
+			if bytes.HasPrefix(p.data[p.off:], []byte(lit)) {
+				p.off += len(lit)
+				return v, nil
+			}
+		}
+	default:
+		if v.kind == '-' || v.kind >= '0' && v.kind <= '9' {
+			v.kind = 0
+			v.s = p.scanNumber()
+			if v.s != "" {
+				return v, nil
+			}
+		}
+	}
+	return nil, p.syntaxError(p.off, "invalid character "+strconv.QuoteRune(rune(p.data[p.off]))+" looking for beginning of value")
+}
+
+// parseString parses the JSON string at the current offset.
+func (p *extJSONParser) parseString() (string, error) {
+	start := p.off
+	for i := start + 1; i < len(p.data); i++ {
+		switch c := p.data[i]; {
+		case c == '\\':
+			i++
+		case c < 0x20:
+			return "", p.syntaxError(i, "invalid control character in string")
+		case c == '"':
+			var s string
+			if err := json.Unmarshal(p.data[start:i+1], &s); err != nil {
+				return "", p.syntaxError(start, "invalid string escape")
+			}
+			if !utf8.Valid(p.data[start:i]) {
+				return "", p.syntaxError(start, "invalid UTF-8 in string")
+			}
+			p.off = i + 1
+			return s, nil
+		}
+	}
+	return "", p.syntaxError(start, "unterminated string")
+}
+
+// scanNumber consumes and returns the JSON number at the current offset,
+// or returns "" if there is none.
+func (p *extJSONParser) scanNumber() string {
+	start, i := p.off, p.off
+	digits := func() int {
+		n := 0
+		for i < len(p.data) && p.data[i] >= '0' && p.data[i] <= '9' {
+			i, n = i+1, n+1
+		}
+		return n
+	}
+	if p.data[i] == '-' {
+		i++
+	}
+	switch n := digits(); {
+	case n == 0:
+		return ""
+	case n > 1 && p.data[i-n] == '0':
+		// leading zeros are not allowed
+		return ""
+	}
+	if i < len(p.data) && p.data[i] == '.' {
+		i++
+		if digits() == 0 {
+			return ""
+		}
+	}
+	if i < len(p.data) && (p.data[i] == 'e' || p.data[i] == 'E') {
+		i++
+		if i < len(p.data) && (p.data[i] == '+' || p.data[i] == '-') {
+			i++
+		}
+		if digits() == 0 {
+			return ""
+		}
+	}
+	p.off = i
+	return string(p.data[start:i])
+}
+
+// convert returns the Go value that Marshal encodes as the BSON equivalent
+// of v. Objects are returned as D, or the type of the wrapper they form.
+func (p *extJSONParser) convert(v *extJSONValue) (interface{}, error) {
+	switch v.kind {
+	case '{':
+		if !p.plain {
+			if x, ok, err := p.convertWrapper(v); ok || err != nil {
+				return x, err
+			}
+		}
+		d := make(D, 0, len(v.members))
+		for _, m := range v.members {
+			if strings.IndexByte(m.key, 0) >= 0 {
+				return nil, p.syntaxError(m.off, "key contains \\0")
+			}
+			x, err := p.convert(m.value)
+			if err != nil {
+				return nil, err
+			}
+			d = append(d, E{Key: m.key, Value: x})
+		}
+		return d, nil
+	case '[':
+		s := make([]interface{}, 0, len(v.elems))
+		for _, elem := range v.elems {
+			x, err := p.convert(elem)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, x)
+		}
+		return s, nil
+	case '"':
+		return v.s, nil
+	case 't', 'f':
+		return v.kind == 't', nil
+	case 'n':
+		return nil, nil
+	default:
+		if !strings.ContainsAny(v.s, ".eE") {
+			if n, err := strconv.ParseInt(v.s, 10, 64); err == nil {
+				if n == int64(int32(n)) {
+					return int32(n), nil
+				}
+				return n, nil
+			}
+		}
+		f, err := strconv.ParseFloat(v.s, 64)
+		if err != nil {
+			return nil, p.syntaxError(v.off, "number "+v.s+" out of range")
+		}
+		return f, nil
+	}
+}
+
+// extJSONKeywords are the keys which mark an object as a type wrapper.
+var extJSONKeywords = map[string]bool{
+	"$oid": true, "$symbol": true, "$numberInt": true, "$numberLong": true,
+	"$numberDouble": true, "$numberDecimal": true, "$binary": true, "$uuid": true,
+	"$code": true, "$timestamp": true, "$regularExpression": true, "$regex": true,
+	"$dbPointer": true, "$date": true, "$minKey": true, "$maxKey": true,
+	"$undefined": true,
+}
+
+// convertWrapper converts the object v if its keys form an Extended JSON
+// type wrapper. It reports false if v is an ordinary document, and returns
+// an error if v uses a wrapper keyword but is malformed.
+func (p *extJSONParser) convertWrapper(v *extJSONValue) (interface{}, bool, error) {
+	var keyword string
+	for _, m := range v.members {
+		if extJSONKeywords[m.key] {
+			keyword = m.key
+			break
+		}
+	}
+	if keyword == "" {
+		return nil, false, nil
+	}
+	x := v.lookup(keyword)
+	if keyword == "$regex" && x.kind != '"' {
+		// the $regex query operator
+		return nil, false, nil
+	}
+	bad := func(msg string) (interface{}, bool, error) {
+		return nil, true, p.syntaxError(v.off, "invalid "+keyword+" wrapper: "+msg)
+	}
+	// shape checks that v has exactly the given keys and that x is of kind.
+	shape := func(kind byte, keys ...string) bool {
+		if len(v.members) != len(keys) || x.kind != kind {
+			return false
+		}
+		for _, key := range keys {
+			if v.lookup(key) == nil {
+				return false
+			}
+		}
+		return true
+	}
+	// regex checks the strings pattern and options, which BSON cannot
+	// hold as written, and returns their Regex.
+	regex := func(pattern, options *extJSONValue) (interface{}, bool, error) {
+		if strings.IndexByte(pattern.s, 0) >= 0 {
+			return nil, true, p.syntaxError(pattern.off, "regex pattern contains \\0")
+		}
+		opts, err := sortRegexOptions(options.s)
+		if err != nil {
+			return nil, true, p.syntaxError(options.off, strings.TrimPrefix(err.Error(), "bson: "))
+		}
+		return Regex{Pattern: pattern.s, Options: opts}, true, nil
+	}
+
+	switch keyword {
+	case "$oid":
+		if !shape('"', "$oid") {
+			return bad("expected a string")
+		}
+		id, err := ObjectIdHex(x.s)
+		if err != nil {
+			return bad("expected 24 hex digits")
+		}
+		return id, true, nil
+	case "$symbol":
+		if !shape('"', "$symbol") {
+			return bad("expected a string")
+		}
+		return Symbol(x.s), true, nil
+	case "$numberInt":
+		if !shape('"', "$numberInt") {
+			return bad("expected a string")
+		}
+		n, err := parseExtJSONInt(x.s, 32)
+		if err != nil {
+			return bad("expected a 32-bit integer")
+		}
+		return int32(n), true, nil
+	case "$numberLong":
+		if !shape('"', "$numberLong") {
+			return bad("expected a string")
+		}
+		n, err := parseExtJSONInt(x.s, 64)
+		if err != nil {
+			return bad("expected a 64-bit integer")
+		}
+		return n, true, nil
+	case "$numberDouble":
+		if !shape('"', "$numberDouble") {
+			return bad("expected a string")
+		}
+		f, err := parseExtJSONDouble(x.s)
+		if err != nil {
+			return bad("expected a number, Infinity, -Infinity or NaN")
+		}
+		return f, true, nil
+	case "$numberDecimal":
+		if !shape('"', "$numberDecimal") {
+			return bad("expected a string")
+		}
+		d, err := ParseDecimal128(x.s)
+		if err != nil {
+			return bad(err.Error())
+		}
+		return d, true, nil
+	case "$binary":
+		var b64, subtype *extJSONValue
+		switch {
+		case shape('{', "$binary"):
+			b64, subtype = x.lookup("base64"), x.lookup("subType")
+			if len(x.members) != 2 || b64 == nil || subtype == nil {
+				return bad(`expected "base64" and "subType" keys`)
+			}
+		case shape('"', "$binary", "$type"):
+			// legacy form
+			b64, subtype = x, v.lookup("$type")
+		default:
+			return bad(`expected an object with "base64" and "subType" keys`)
+		}
+		if b64.kind != '"' || subtype.kind != '"' {
+			return bad("expected string values")
+		}
+		data, err := base64.StdEncoding.DecodeString(b64.s)
+		if err != nil {
+			return bad("invalid base64")
+		}
+		st, err := strconv.ParseUint(subtype.s, 16, 8)
+		if err != nil || len(subtype.s) > 2 {
+			return bad("expected a one byte hex subtype")
+		}
+		return Binary{Subtype: byte(st), Data: data}, true, nil
+	case "$uuid":
+		if !shape('"', "$uuid") {
+			return bad("expected a string")
+		}
+		s := x.s
+		if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			return bad("expected a hyphenated UUID")
+		}
+		data, err := hex.DecodeString(s[:8] + s[9:13] + s[14:18] + s[19:23] + s[24:])
+		if err != nil {
+			return bad("expected a hyphenated UUID")
+		}
+		return Binary{Subtype: 0x04, Data: data}, true, nil
+	case "$code":
+		if shape('"', "$code") {
+			return JavaScript(x.s), true, nil
+		}
+		scope := v.lookup("$scope")
+		if !shape('"', "$code", "$scope") || scope.kind != '{' {
+			return bad(`expected a string and optional "$scope" document`)
+		}
+		d, err := p.convert(scope)
+		if err != nil {
+			return nil, true, err
+		}
+		if _, ok := d.(D); !ok {
+			return bad(`expected a "$scope" document`)
+		}
+		return CodeWithScope{Code: x.s, Scope: d}, true, nil
+	case "$timestamp":
+		if !shape('{', "$timestamp") || len(x.members) != 2 {
+			return bad(`expected an object with "t" and "i" keys`)
+		}
+		t, err1 := parseExtJSONUint32(x.lookup("t"))
+		i, err2 := parseExtJSONUint32(x.lookup("i"))
+		if err1 != nil || err2 != nil {
+			return bad(`expected unsigned 32-bit integers for "t" and "i"`)
+		}
+		return NewTimestamp(t, i), true, nil
+	case "$regularExpression":
+		if !shape('{', "$regularExpression") || len(x.members) != 2 {
+			return bad(`expected an object with "pattern" and "options" keys`)
+		}
+		pattern, options := x.lookup("pattern"), x.lookup("options")
+		if pattern == nil || options == nil || pattern.kind != '"' || options.kind != '"' {
+			return bad(`expected string "pattern" and "options"`)
+		}
+		return regex(pattern, options)
+	case "$regex":
+		options := v.lookup("$options")
+		if !shape('"', "$regex", "$options") || options.kind != '"' {
+			return bad(`expected string "$regex" and "$options"`)
+		}
+		return regex(x, options)
+	case "$dbPointer":
+		if !shape('{', "$dbPointer") || len(x.members) != 2 {
+			return bad(`expected an object with "$ref" and "$id" keys`)
+		}
+		ref, id := x.lookup("$ref"), x.lookup("$id")
+		if ref == nil || id == nil || ref.kind != '"' {
+			return bad(`expected a string "$ref" and ObjectId "$id"`)
+		}
+		oid, err := p.convert(id)
+		if err != nil {
+			return nil, true, err
+		}
+		if _, ok := oid.(ObjectId); !ok {
+			return bad(`expected an ObjectId "$id"`)
+		}
+		return DBPointer{Ref: ref.s, ID: oid.(ObjectId)}, true, nil
+	case "$date":
+		if len(v.members) != 1 {
+			return bad("unexpected keys")
+		}
+		switch x.kind {
+		case '"':
+			t, err := time.Parse(time.RFC3339Nano, x.s)
+			if err != nil {
+				return bad("expected an ISO-8601 date")
+			}
+			return NewDatetime(t), true, nil
+		case '{':
+			n := x.lookup("$numberLong")
+			if len(x.members) != 1 || n == nil || n.kind != '"' {
+				return bad(`expected a "$numberLong"`)
+			}
+			ms, err := parseExtJSONInt(n.s, 64)
+			if err != nil {
+				return bad("expected a 64-bit integer")
+			}
+			return Datetime(ms), true, nil
+		case 0:
+			// legacy form
+			ms, err := parseExtJSONInt(x.s, 64)
+			if err != nil {
+				return bad("expected a 64-bit integer")
+			}
+			return Datetime(ms), true, nil
+		}
+		return bad("expected a string, number or $numberLong")
+	case "$minKey", "$maxKey":
+		if !shape(0, keyword) || x.s != "1" {
+			return bad("expected 1")
+		}
+		if keyword == "$minKey" {
+			return MinKey{}, true, nil
+		}
+		return MaxKey{}, true, nil
+	case "$undefined":
+		if !shape('t', "$undefined") {
+			return bad("expected true")
+		}
+		return Undefined{}, true, nil
+	}
+	return nil, false, nil
+}
+
+// parseExtJSONInt parses a decimal integer of the given bit size, without
+// the leading '+' or whitespace strconv would otherwise accept.
+func parseExtJSONInt(s string, bitSize int) (int64, error) {
+	if strings.HasPrefix(s, "+") {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseInt(s, 10, bitSize)
+}
+
+// parseExtJSONUint32 returns the value of the JSON number v as a uint32.
+func parseExtJSONUint32(v *extJSONValue) (uint32, error) {
+	if v == nil || v.kind != 0 {
+		return 0, strconv.ErrSyntax
+	}
+	n, err := strconv.ParseUint(v.s, 10, 32)
+	return uint32(n), err
+}
+
+// parseExtJSONDouble parses the value of a $numberDouble wrapper, as
+// formatted by formatExtJSONDouble.
+func parseExtJSONDouble(s string) (float64, error) {
+	switch s {
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	case "NaN":
+		// the canonical quiet NaN, rather than Go's math.NaN()
+		return math.Float64frombits(0x7ff8000000000000), nil
+	}
+	if strings.HasPrefix(s, "+") || strings.ContainsAny(s, "xXpP_") {
+		// reject the signed and hexadecimal forms ParseFloat allows
+		return 0, strconv.ErrSyntax
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, strconv.ErrSyntax
+	}
+	return f, nil
+}
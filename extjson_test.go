@@ -0,0 +1,259 @@
+package bson
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMarshalExtJSON(t *testing.T) {
+	oid, _ := ObjectIdHex("5a934e000102030405000000")
+	dec, _ := ParseDecimal128("1.5E+3")
+	tests := []struct {
+		v         interface{}
+		canonical string
+		relaxed   string
+	}{{
+		v:         D{{"d", 1.0}, {"e", math.Copysign(0, -1)}, {"f", 1.5e20}, {"g", 1e-7}, {"h", math.Inf(-1)}, {"i", math.NaN()}},
+		canonical: `{"d":{"$numberDouble":"1.0"},"e":{"$numberDouble":"-0.0"},"f":{"$numberDouble":"1.5E+20"},"g":{"$numberDouble":"1.0E-7"},"h":{"$numberDouble":"-Infinity"},"i":{"$numberDouble":"NaN"}}`,
+		relaxed:   `{"d":1.0,"e":-0.0,"f":1.5E+20,"g":1.0E-7,"h":{"$numberDouble":"-Infinity"},"i":{"$numberDouble":"NaN"}}`,
+	}, {
+		v:         D{{"a", int32(-7)}, {"b", int64(1) << 40}, {"c", dec}},
+		canonical: `{"a":{"$numberInt":"-7"},"b":{"$numberLong":"1099511627776"},"c":{"$numberDecimal":"1.5E+3"}}`,
+		relaxed:   `{"a":-7,"b":1099511627776,"c":{"$numberDecimal":"1.5E+3"}}`,
+	}, {
+		v:         D{{"s", "a\"b\\c\n\x01é"}, {"t", true}, {"n", nil}, {"doc", D{{"x", []interface{}{"y", false}}}}},
+		canonical: `{"s":"a\"b\\c\n\u0001é","t":true,"n":null,"doc":{"x":["y",false]}}`,
+		relaxed:   `{"s":"a\"b\\c\n\u0001é","t":true,"n":null,"doc":{"x":["y",false]}}`,
+	}, {
+		v:         D{{"a", Datetime(1356351330501)}, {"b", Datetime(0)}, {"c", Datetime(-1)}, {"d", Datetime(253402300800000)}},
+		canonical: `{"a":{"$date":{"$numberLong":"1356351330501"}},"b":{"$date":{"$numberLong":"0"}},"c":{"$date":{"$numberLong":"-1"}},"d":{"$date":{"$numberLong":"253402300800000"}}}`,
+		relaxed:   `{"a":{"$date":"2012-12-24T12:15:30.501Z"},"b":{"$date":"1970-01-01T00:00:00Z"},"c":{"$date":{"$numberLong":"-1"}},"d":{"$date":{"$numberLong":"253402300800000"}}}`,
+	}, {
+		v: D{
+			{"oid", oid},
+			{"bin", Binary{Subtype: 0x04, Data: []byte{0x73, 0xff, 0xd2, 0x64}}},
+			{"old", Binary{Subtype: 0x02, Data: []byte{0xff, 0xff}}},
+			{"bytes", []byte("hi")},
+			{"ts", NewTimestamp(123456789, 42)},
+			{"re", Regex{Pattern: "^a\\d", Options: "im"}},
+		},
+		canonical: `{"oid":{"$oid":"5a934e000102030405000000"},"bin":{"$binary":{"base64":"c//SZA==","subType":"04"}},"old":{"$binary":{"base64":"//8=","subType":"02"}},"bytes":{"$binary":{"base64":"aGk=","subType":"00"}},"ts":{"$timestamp":{"t":123456789,"i":42}},"re":{"$regularExpression":{"pattern":"^a\\d","options":"im"}}}`,
+	}, {
+		v: D{
+			{"js", JavaScript("f()")},
+			{"cws", CodeWithScope{Code: "g(x)", Scope: D{{"x", int32(1)}}}},
+			{"sym", Symbol("s")},
+			{"ptr", DBPointer{Ref: "db.c", ID: oid}},
+			{"u", Undefined{}},
+			{"min", MinKey{}},
+			{"max", MaxKey{}},
+		},
+		canonical: `{"js":{"$code":"f()"},"cws":{"$code":"g(x)","$scope":{"x":{"$numberInt":"1"}}},"sym":{"$symbol":"s"},"ptr":{"$dbPointer":{"$ref":"db.c","$id":{"$oid":"5a934e000102030405000000"}}},"u":{"$undefined":true},"min":{"$minKey":1},"max":{"$maxKey":1}}`,
+		relaxed:   `{"js":{"$code":"f()"},"cws":{"$code":"g(x)","$scope":{"x":1}},"sym":{"$symbol":"s"},"ptr":{"$dbPointer":{"$ref":"db.c","$id":{"$oid":"5a934e000102030405000000"}}},"u":{"$undefined":true},"min":{"$minKey":1},"max":{"$maxKey":1}}`,
+	}, {
+		v:         struct{ When time.Time }{time.Date(2018, 2, 26, 0, 0, 0, 0, time.UTC)},
+		canonical: `{"When":{"$date":{"$numberLong":"1519603200000"}}}`,
+		relaxed:   `{"When":{"$date":"2018-02-26T00:00:00Z"}}`,
+	}, {
+		v:         Raw("\x16\x00\x00\x00\x02hello\x00\x06\x00\x00\x00world\x00\x00"),
+		canonical: `{"hello":"world"}`,
+	}, {
+		// Validate rejects these, but they are rendered as best we can
+		v:         Raw("\x09\x00\x00\x00\x08b\x00\x02\x00"),
+		canonical: `{"b":false}`,
+	}, {
+		v:         Raw("\x0e\x00\x00\x00\x02s\x00\x02\x00\x00\x00\xff\x00\x00"),
+		canonical: "{\"s\":\"\ufffd\"}",
+	}}
+	for _, tt := range tests {
+		if tt.relaxed == "" {
+			tt.relaxed = tt.canonical
+		}
+		for _, canonical := range []bool{true, false} {
+			want := tt.relaxed
+			if canonical {
+				want = tt.canonical
+			}
+			got, err := MarshalExtJSON(tt.v, canonical)
+			if err != nil {
+				t.Errorf("MarshalExtJSON(%v, %v): %v", tt.v, canonical, err)
+				continue
+			}
+			if string(got) != want {
+				t.Errorf("MarshalExtJSON(%v, %v):\nexpected %s\n     got %s", tt.v, canonical, want, got)
+			}
+		}
+	}
+}
+
+func TestMarshalExtJSONInvalid(t *testing.T) {
+	// truncated document
+	if _, err := MarshalExtJSON(Raw("\x0c\x00\x00\x00\x02a\x00\x02\x00\x00\x00b"), true); err == nil {
+		t.Errorf("MarshalExtJSON: expected error for corrupt document")
+	}
+	if _, err := MarshalExtJSON(42, true); err == nil {
+		t.Errorf("MarshalExtJSON: expected error for non-document")
+	}
+}
+
+func TestMarshalExtJSONValue(t *testing.T) {
+	tests := []struct {
+		v         RawValue
+		canonical string
+		relaxed   string
+	}{
+		{RawValue{Type: 0x10, Value: []byte{1, 0, 0, 0}}, `{"$numberInt":"1"}`, `1`},
+		{RawValue{Type: 0x02, Value: []byte("\x02\x00\x00\x00x\x00")}, `"x"`, `"x"`},
+		{RawValue{Type: 0x04, Value: []byte("\x09\x00\x00\x00\x080\x00\x01\x00")}, `[true]`, `[true]`},
+		{RawValue{Type: 0x0a}, `null`, `null`},
+	}
+	for _, tt := range tests {
+		for _, canonical := range []bool{true, false} {
+			want := tt.relaxed
+			if canonical {
+				want = tt.canonical
+			}
+			got, err := MarshalExtJSONValue(tt.v, canonical)
+			if err != nil || string(got) != want {
+				t.Errorf("MarshalExtJSONValue(%v, %v): expected %s, got %s, %v", tt.v, canonical, want, got, err)
+			}
+		}
+	}
+
+	for _, v := range []RawValue{
+		{Type: 0x10, Value: []byte{1, 0, 0}},
+		{Type: 0x10, Value: []byte{1, 0, 0, 0, 0}},
+		{Type: 0x02, Value: []byte("\x05\x00\x00\x00x\x00")},
+		{Type: 0x03, Value: []byte("\x05\x00\x00\x00\x01")},
+	} {
+		if got, err := MarshalExtJSONValue(v, true); err == nil {
+			t.Errorf("MarshalExtJSONValue(%v): expected error, got %s", v, got)
+		}
+	}
+}
+
+func TestUnmarshalExtJSON(t *testing.T) {
+	oid, _ := ObjectIdHex("5a934e000102030405000000")
+	tests := []struct {
+		json string
+		want D
+	}{
+		{`{}`, D{}},
+		{`{"b": 1, "a": [true, null, "x"]}`, D{{"b", int32(1)}, {"a", []interface{}{true, nil, "x"}}}},
+		{`{"n": 2147483648, "m": -2147483648, "f": 1.5, "g": 1e3, "h": 9223372036854775808}`,
+			D{{"n", int64(2147483648)}, {"m", int32(-2147483648)}, {"f", 1.5}, {"g", 1000.0}, {"h", 9223372036854775808.0}}},
+		{"{\"s\": \"a\\u00e9\\n\\\"\\ud83d\\ude00\"}", D{{"s", "aé\n\"😀"}}},
+		{`{"i": {"$numberInt": "-7"}, "l": {"$numberLong": "1099511627776"}, "d": {"$numberDouble": "-Infinity"}, "z": {"$numberDouble": "-0.0"}}`,
+			D{{"i", int32(-7)}, {"l", int64(1099511627776)}, {"d", math.Inf(-1)}, {"z", math.Copysign(0, -1)}}},
+		{`{"oid": {"$oid": "5a934e000102030405000000"}, "sym": {"$symbol": "s"}}`, D{{"oid", oid}, {"sym", Symbol("s")}}},
+		{`{"b": {"$binary": {"subType": "4", "base64": "c//SZA=="}}, "old": {"$type": "80", "$binary": "aGk="}, "u": {"$uuid": "73ffd264-44b3-4c69-90e8-e7d1dfc035d4"}}`,
+			D{{"b", Binary{Subtype: 4, Data: []byte{0x73, 0xff, 0xd2, 0x64}}}, {"old", Binary{Subtype: 0x80, Data: []byte("hi")}},
+				{"u", Binary{Subtype: 4, Data: []byte{0x73, 0xff, 0xd2, 0x64, 0x44, 0xb3, 0x4c, 0x69, 0x90, 0xe8, 0xe7, 0xd1, 0xdf, 0xc0, 0x35, 0xd4}}}}},
+		{`{"c": {"$code": "f()"}, "cws": {"$scope": {"x": 1}, "$code": "g(x)"}}`,
+			D{{"c", JavaScript("f()")}, {"cws", CodeWithScope{Code: "g(x)", Scope: D{{"x", int32(1)}}}}}},
+		{`{"ts": {"$timestamp": {"t": 123456789, "i": 42}}, "p": {"$dbPointer": {"$ref": "db.c", "$id": {"$oid": "5a934e000102030405000000"}}}}`,
+			D{{"ts", NewTimestamp(123456789, 42)}, {"p", DBPointer{Ref: "db.c", ID: oid}}}},
+		{`{"r": {"$regularExpression": {"pattern": "^a", "options": "mi"}}, "l": {"$regex": "b", "$options": ""}, "q": {"$regex": {"$regularExpression": {"pattern": "c", "options": ""}}}}`,
+			D{{"r", Regex{Pattern: "^a", Options: "im"}}, {"l", Regex{Pattern: "b"}}, {"q", D{{"$regex", Regex{Pattern: "c"}}}}}},
+		{`{"a": {"$date": "2012-12-24T12:15:30.501Z"}, "b": {"$date": {"$numberLong": "-1"}}, "c": {"$date": 1356351330501}}`,
+			D{{"a", Datetime(1356351330501)}, {"b", Datetime(-1)}, {"c", Datetime(1356351330501)}}},
+		{`{"min": {"$minKey": 1}, "max": {"$maxKey": 1}, "u": {"$undefined": true}, "dec": {"$numberDecimal": "1.5E+3"}}`,
+			D{{"min", MinKey{}}, {"max", MaxKey{}}, {"u", Undefined{}}, {"dec", mustDecimal128(t, "1.5E+3")}}},
+		{`{"$ref": "c", "$id": 1, "x": {"$gt": 1}}`, D{{"$ref", "c"}, {"$id", int32(1)}, {"x", D{{"$gt", int32(1)}}}}},
+	}
+	for _, tt := range tests {
+		got, err := UnmarshalExtJSON([]byte(tt.json))
+		if err != nil {
+			t.Errorf("UnmarshalExtJSON(%s): %v", tt.json, err)
+			continue
+		}
+		want, err := Marshal(tt.want)
+		if err != nil {
+			t.Fatalf("Marshal(%v): %v", tt.want, err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("UnmarshalExtJSON(%s):\nexpected %q\n     got %q", tt.json, want, got)
+		}
+	}
+}
+
+func mustDecimal128(t *testing.T, s string) Decimal128 {
+	d, err := ParseDecimal128(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestUnmarshalExtJSONErrors(t *testing.T) {
+	tests := []struct {
+		json      string
+		line, col int
+	}{
+		{``, 1, 1},
+		{`[]`, 1, 1},
+		{`{"a": 1,}`, 1, 9},
+		{"{\n  \"a\": tru\n}", 2, 8},
+		{"{\n  \"a\": 01\n}", 2, 8},
+		{`{"a": "b`, 1, 7},
+		{"{\"a\": \"\x01\"}", 1, 8},
+		{`{"a": 1} x`, 1, 10},
+		{`{"a" 1}`, 1, 6},
+		{"{\"a\":\n\t{\"$oid\": \"xyz\"}}", 2, 2},
+		{`{"a": {"$numberInt": "2147483648"}}`, 1, 7},
+		{`{"a": {"$numberInt": 1}}`, 1, 7},
+		{`{"a": {"$numberLong": "+1"}}`, 1, 7},
+		{`{"a": {"$numberDouble": "inf"}}`, 1, 7},
+		{`{"a": {"$numberDouble": "0x1p3"}}`, 1, 7},
+		{`{"a": {"$binary": {"base64": "!", "subType": "00"}}}`, 1, 7},
+		{`{"a": {"$binary": {"base64": "", "subType": "100"}}}`, 1, 7},
+		{`{"a": {"$oid": "5a934e000102030405000000", "x": 1}}`, 1, 7},
+		{`{"a": {"$timestamp": {"t": -1, "i": 0}}}`, 1, 7},
+		{`{"a": {"$date": "yesterday"}}`, 1, 7},
+		{`{"a": {"$minKey": 0}}`, 1, 7},
+		{`{"a": {"$uuid": "73ffd264-44b3-4c69-90e8-e7d1dfc035d"}}`, 1, 7},
+		{`{"a": {"$code": "f()", "$scope": 1}}`, 1, 7},
+		{`{"r":{"$regularExpression":{"pattern":"a","options":"g"}}}`, 1, 53},
+		{`{"r": {"$regex": "a", "$options": "ii"}}`, 1, 35},
+		{`{"r": {"$regex": "a\u0000", "$options": ""}}`, 1, 18},
+		{`{"a\u0000": 1}`, 1, 2},
+		{"{\"x\": {\n\t\"a\\u0000\": 1}}", 2, 2},
+	}
+	for _, tt := range tests {
+		_, err := UnmarshalExtJSON([]byte(tt.json))
+		e, ok := err.(*ExtJSONSyntaxError)
+		if !ok {
+			t.Errorf("UnmarshalExtJSON(%q): expected *ExtJSONSyntaxError, got %v", tt.json, err)
+			continue
+		}
+		if e.Line != tt.line || e.Column != tt.col {
+			t.Errorf("UnmarshalExtJSON(%q): expected line %d, column %d, got %v", tt.json, tt.line, tt.col, err)
+		}
+	}
+}
+
+func TestExtJSONRoundTrip(t *testing.T) {
+	oid, _ := ObjectIdHex("5a934e000102030405000000")
+	doc := D{
+		{"d", 1.0}, {"i", int32(1)}, {"l", int64(1)}, {"s", "x"}, {"o", oid},
+		{"dt", Datetime(-62135596800000)}, {"b", Binary{Subtype: 0x02, Data: []byte{1}}},
+		{"a", []interface{}{D{{"x", nil}}, Undefined{}}}, {"ts", NewTimestamp(1, 2)},
+		{"cws", CodeWithScope{Code: "f", Scope: D{{"y", MinKey{}}}}}, {"dec", mustDecimal128(t, "-0.00")},
+	}
+	want, err := Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := MarshalExtJSON(Raw(want), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnmarshalExtJSON(js)
+	if err != nil {
+		t.Fatalf("UnmarshalExtJSON(%s): %v", js, err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("round trip through %s:\nexpected %q\n     got %q", js, want, got)
+	}
+}
@@ -0,0 +1,180 @@
+package bson
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"math"
+	"strconv"
+)
+
+// JSONOptions controls how MarshalJSON renders the BSON types which plain
+// JSON has no equivalent for. The zero value selects the defaults.
+type JSONOptions struct {
+	ObjectId ObjectIdFormat
+	Datetime DatetimeFormat
+	Binary   BinaryFormat
+}
+
+// ObjectIdFormat selects how MarshalJSON renders ObjectIds.
+type ObjectIdFormat int
+
+const (
+	ObjectIdAsHex    ObjectIdFormat = iota // "5a934e000102030405000000"
+	ObjectIdAsString                       // "ObjectId(\"5a934e000102030405000000\")"
+)
+
+// DatetimeFormat selects how MarshalJSON renders datetimes.
+type DatetimeFormat int
+
+const (
+	DatetimeAsRFC3339 DatetimeFormat = iota // "2012-12-24T12:15:30.501Z"
+	DatetimeAsMillis                        // 1356351330501, milliseconds since the Unix epoch
+)
+
+// BinaryFormat selects how MarshalJSON renders binary data.
+type BinaryFormat int
+
+const (
+	BinaryAsBase64 BinaryFormat = iota // standard base64, as encoding/json renders []byte
+	BinaryAsHex                        // lowercase hexadecimal
+)
+
+// MarshalJSON returns a plain JSON representation of the BSON encoding of
+// v, without the type wrappers of Extended JSON, suitable for consumers
+// using encoding/json. v may be anything Marshal accepts, including a Raw
+// holding an existing document. If opts is nil the defaults are used.
+//
+// The conversion loses type information. Documents, arrays, strings,
+// booleans, null and numbers map to their JSON equivalents, with doubles
+// written as in relaxed Extended JSON; NaN and infinite doubles, which JSON
+// cannot represent, become null. ObjectIds, datetimes and binary data
+// (whatever its subtype) are rendered as selected by opts. Decimal128
+// values are written as strings to preserve their precision, regular
+// expressions as "/pattern/options" strings, JavaScript code and symbols
+// as strings, code with scope as {"code": ..., "scope": ...}, DBPointers
+// as {"ref": ..., "id": ...} and timestamps as {"t": ..., "i": ...}.
+// Undefined, MinKey and MaxKey become null.
+func MarshalJSON(v interface{}, opts *JSONOptions) ([]byte, error) {
+	data, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateDocument(data, false, 0); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = new(JSONOptions)
+	}
+	return appendJSONDocument(nil, data, false, opts), nil
+}
+
+// UnmarshalJSON parses the JSON object data and returns its BSON encoding.
+// Keys keep the order they have in data. Numbers become int32 or int64 if
+// they are integers that fit, and double otherwise; all strings, including
+// those MarshalJSON produced from ObjectIds, datetimes or binary data,
+// remain strings. Objects are not interpreted as Extended JSON type
+// wrappers; see UnmarshalExtJSON for that. Malformed input is reported as
+// an *ExtJSONSyntaxError.
+func UnmarshalJSON(data []byte) ([]byte, error) {
+	return unmarshalJSON(extJSONParser{data: data, plain: true})
+}
+
+// appendJSONDocument appends the plain JSON representation of the valid
+// BSON document data to b, as a JSON array if array is true.
+func appendJSONDocument(b []byte, data []byte, array bool, opts *JSONOptions) []byte {
+	open, close := byte('{'), byte('}')
+	if array {
+		open, close = '[', ']'
+	}
+	b = append(b, open)
+	iter := newReader(data)
+	for i := 0; iter.Next(); i++ {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		typ, ename, element := iter.Element()
+		if !array {
+			b = appendJSONString(b, string(trimlast(ename)))
+			b = append(b, ':')
+		}
+		b = appendJSONValue(b, typ, element, opts)
+	}
+	return append(b, close)
+}
+
+// appendJSONValue appends the plain JSON representation of the BSON
+// element of type typ to b.
+func appendJSONValue(b []byte, typ byte, element []byte, opts *JSONOptions) []byte {
+	switch typ {
+	case 0x01:
+		if f := math.Float64frombits(uint64(readInt64(element))); math.IsInf(f, 0) || math.IsNaN(f) {
+			return append(b, "null"...)
+		}
+	case 0x03:
+		return appendJSONDocument(b, element, false, opts)
+	case 0x04:
+		return appendJSONDocument(b, element, true, opts)
+	case 0x05:
+		data := element[1:]
+		if element[0] == 0x02 {
+			data = data[4:]
+		}
+		if opts.Binary == BinaryAsHex {
+			return appendJSONString(b, hex.EncodeToString(data))
+		}
+		return appendJSONString(b, base64.StdEncoding.EncodeToString(data))
+	case 0x06, 0x7f, 0xff:
+		return append(b, "null"...)
+	case 0x07:
+		return appendJSONObjectId(b, element, opts)
+	case 0x0c:
+		n, _ := readInt32(element)
+		b = append(b, `{"ref":`...)
+		b = appendJSONString(b, string(element[sizeofInt32:sizeofInt32+n-1]))
+		b = append(b, `,"id":`...)
+		b = appendJSONObjectId(b, element[sizeofInt32+n:], opts)
+		return append(b, '}')
+	case 0x09:
+		ms := readInt64(element)
+		if opts.Datetime == DatetimeAsMillis {
+			return strconv.AppendInt(b, ms, 10)
+		}
+		return appendJSONString(b, Datetime(ms).Time().Format("2006-01-02T15:04:05.999Z07:00"))
+	case 0x0b:
+		i := bytes.IndexByte(element, 0)
+		return appendJSONString(b, "/"+string(element[:i])+"/"+string(trimlast(element[i+1:])))
+	case 0x0d, 0x0e:
+		return appendJSONString(b, string(trimlast(element)))
+	case 0x0f:
+		n, _ := readInt32(element[sizeofInt32:])
+		b = append(b, `{"code":`...)
+		b = appendJSONString(b, string(element[2*sizeofInt32:2*sizeofInt32+n-1]))
+		b = append(b, `,"scope":`...)
+		b = appendJSONDocument(b, element[2*sizeofInt32+n:], false, opts)
+		return append(b, '}')
+	case 0x11:
+		ts := Timestamp(readInt64(element))
+		b = append(b, `{"t":`...)
+		b = strconv.AppendUint(b, uint64(ts.T()), 10)
+		b = append(b, `,"i":`...)
+		b = strconv.AppendUint(b, uint64(ts.I()), 10)
+		return append(b, '}')
+	case 0x13:
+		d := Decimal128{h: uint64(readInt64(element[8:])), l: uint64(readInt64(element))}
+		return appendJSONString(b, d.String())
+	}
+	// strings, booleans, null and numbers are the same as relaxed
+	// Extended JSON.
+	return appendExtJSONValue(b, typ, element, false)
+}
+
+// appendJSONObjectId appends the ObjectId element to b as selected by opts.
+func appendJSONObjectId(b []byte, element []byte, opts *JSONOptions) []byte {
+	var id ObjectId
+	copy(id[:], element)
+	if opts.ObjectId == ObjectIdAsString {
+		return appendJSONString(b, id.String())
+	}
+	return appendJSONString(b, id.Hex())
+}
@@ -0,0 +1,83 @@
+package bson
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	oid, _ := ObjectIdHex("5a934e000102030405000000")
+	doc := D{
+		{"d", 1.5}, {"nan", math.NaN()}, {"i", int32(-7)}, {"l", int64(1) << 40}, {"s", "x\"y"},
+		{"oid", oid}, {"dt", Datetime(1356351330501)}, {"bin", Binary{Subtype: 0x04, Data: []byte{0x73, 0xff}}},
+		{"a", []interface{}{true, nil, D{{"n", int32(1)}}}},
+		{"re", Regex{Pattern: "^a", Options: "i"}}, {"js", JavaScript("f()")}, {"sym", Symbol("s")},
+		{"cws", CodeWithScope{Code: "g(x)", Scope: D{{"x", int32(1)}}}},
+		{"ptr", DBPointer{Ref: "db.c", ID: oid}}, {"ts", NewTimestamp(1, 2)},
+		{"dec", mustDecimal128(t, "0.1")}, {"u", Undefined{}}, {"min", MinKey{}}, {"max", MaxKey{}},
+	}
+	tests := []struct {
+		opts *JSONOptions
+		want string
+	}{{
+		opts: nil,
+		want: `{"d":1.5,"nan":null,"i":-7,"l":1099511627776,"s":"x\"y",` +
+			`"oid":"5a934e000102030405000000","dt":"2012-12-24T12:15:30.501Z","bin":"c/8=",` +
+			`"a":[true,null,{"n":1}],"re":"/^a/i","js":"f()","sym":"s",` +
+			`"cws":{"code":"g(x)","scope":{"x":1}},"ptr":{"ref":"db.c","id":"5a934e000102030405000000"},` +
+			`"ts":{"t":1,"i":2},"dec":"0.1","u":null,"min":null,"max":null}`,
+	}, {
+		opts: &JSONOptions{ObjectId: ObjectIdAsString, Datetime: DatetimeAsMillis, Binary: BinaryAsHex},
+		want: `{"d":1.5,"nan":null,"i":-7,"l":1099511627776,"s":"x\"y",` +
+			`"oid":"ObjectId(\"5a934e000102030405000000\")","dt":1356351330501,"bin":"73ff",` +
+			`"a":[true,null,{"n":1}],"re":"/^a/i","js":"f()","sym":"s",` +
+			`"cws":{"code":"g(x)","scope":{"x":1}},"ptr":{"ref":"db.c","id":"ObjectId(\"5a934e000102030405000000\")"},` +
+			`"ts":{"t":1,"i":2},"dec":"0.1","u":null,"min":null,"max":null}`,
+	}}
+	for _, tt := range tests {
+		got, err := MarshalJSON(doc, tt.opts)
+		if err != nil {
+			t.Fatalf("MarshalJSON: %v", err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("MarshalJSON(%+v):\nexpected %s\n     got %s", tt.opts, tt.want, got)
+		}
+		if !json.Valid(got) {
+			t.Errorf("MarshalJSON(%+v): invalid JSON %s", tt.opts, got)
+		}
+	}
+
+	// the default rendering of binary data matches encoding/json
+	b, _ := MarshalJSON(D{{"b", []byte("hello")}}, nil)
+	var v struct{ B []byte }
+	if err := json.Unmarshal(b, &v); err != nil || string(v.B) != "hello" {
+		t.Errorf("json.Unmarshal(%s): got %q, %v", b, v.B, err)
+	}
+
+	// invalid UTF-8, which Validate rejects, is replaced
+	b, err := MarshalJSON(Raw("\x0e\x00\x00\x00\x02s\x00\x02\x00\x00\x00\xff\x00\x00"), nil)
+	if want := "{\"s\":\"\ufffd\"}"; err != nil || string(b) != want {
+		t.Errorf("MarshalJSON: expected %s, got %s, %v", want, b, err)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	got, err := UnmarshalJSON([]byte(`{"z": 1, "big": 4294967296, "f": 2.0, "e": 1e2, "oid": {"$oid": "5a934e000102030405000000"}, "a": ["x", null, false]}`))
+	if err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+	want, _ := Marshal(D{
+		{"z", int32(1)}, {"big", int64(4294967296)}, {"f", 2.0}, {"e", 100.0},
+		{"oid", D{{"$oid", "5a934e000102030405000000"}}}, {"a", []interface{}{"x", nil, false}},
+	})
+	if string(got) != string(want) {
+		t.Errorf("UnmarshalJSON:\nexpected %q\n     got %q", want, got)
+	}
+
+	if _, err := UnmarshalJSON([]byte("{\n\"a\": [1 2]}")); err == nil {
+		t.Errorf("UnmarshalJSON: expected error")
+	} else if e, ok := err.(*ExtJSONSyntaxError); !ok || e.Line != 2 || e.Column != 9 {
+		t.Errorf("UnmarshalJSON: expected error at line 2, column 9, got %v", err)
+	}
+}
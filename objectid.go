@@ -0,0 +1,148 @@
+package bson
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// objectIdProcess is the per-process random part of new ObjectIds and
+// objectIdCounter the counter, which starts at a random value.
+var (
+	objectIdProcess [5]byte
+	objectIdCounter uint32
+)
+
+func init() {
+	var b [8]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		// fall back to something that differs between processes
+		binary.BigEndian.PutUint64(b[:], uint64(time.Now().UnixNano()))
+	}
+	copy(objectIdProcess[:], b[:5])
+	objectIdCounter = uint32(b[5])<<16 | uint32(b[6])<<8 | uint32(b[7])
+}
+
+// NewObjectId returns a new unique ObjectId for the current time.
+// It is safe for concurrent use.
+func NewObjectId() ObjectId {
+	return newObjectId(time.Now(), atomic.AddUint32(&objectIdCounter, 1))
+}
+
+func newObjectId(t time.Time, n uint32) ObjectId {
+	var id ObjectId
+	binary.BigEndian.PutUint32(id[:], objectIdSeconds(t))
+	copy(id[4:9], objectIdProcess[:])
+	id[9], id[10], id[11] = byte(n>>16), byte(n>>8), byte(n)
+	return id
+}
+
+// ObjectIdFromTime returns the lowest ObjectId with the creation time t,
+// truncated to the second. Together with MaxObjectIdFromTime it bounds the
+// ObjectIds created in a time window:
+//
+//	ObjectIdFromTime(from).Compare(id) <= 0 && id.Compare(MaxObjectIdFromTime(to)) <= 0
+//
+// Times outside the range an ObjectId can represent, 1970 to 2106, are
+// clamped to it.
+func ObjectIdFromTime(t time.Time) ObjectId {
+	var id ObjectId
+	binary.BigEndian.PutUint32(id[:], objectIdSeconds(t))
+	return id
+}
+
+// MaxObjectIdFromTime returns the highest ObjectId with the creation time
+// t, truncated to the second. See ObjectIdFromTime.
+func MaxObjectIdFromTime(t time.Time) ObjectId {
+	id := ObjectId{0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	binary.BigEndian.PutUint32(id[:], objectIdSeconds(t))
+	return id
+}
+
+// objectIdSeconds returns the seconds since the Unix epoch of t, clamped
+// to the range of an ObjectId's creation time.
+func objectIdSeconds(t time.Time) uint32 {
+	switch s := t.Unix(); {
+	case s < 0:
+		return 0
+	case s > 1<<32-1:
+		return 1<<32 - 1
+	default:
+		return uint32(s)
+	}
+}
+
+// Compare returns -1, 0 or +1 depending on whether id orders before, the
+// same as, or after other. ObjectIds order as BSON does, byte by byte,
+// so earlier creation times order first.
+func (id ObjectId) Compare(other ObjectId) int {
+	return bytes.Compare(id[:], other[:])
+}
+
+// Before reports whether id orders before other.
+func (id ObjectId) Before(other ObjectId) bool { return id.Compare(other) < 0 }
+
+// After reports whether id orders after other.
+func (id ObjectId) After(other ObjectId) bool { return id.Compare(other) > 0 }
+
+// ObjectIdHex returns the ObjectId represented by the 24 digit
+// hexadecimal string s.
+func ObjectIdHex(s string) (ObjectId, error) {
+	var id ObjectId
+	if len(s) != 2*len(id) {
+		return id, errors.New("bson: invalid ObjectId hex " + strconv.Quote(s))
+	}
+	if _, err := hex.Decode(id[:], []byte(s)); err != nil {
+		return ObjectId{}, errors.New("bson: invalid ObjectId hex " + strconv.Quote(s))
+	}
+	return id, nil
+}
+
+// Hex returns the 24 digit lowercase hexadecimal representation of id.
+func (id ObjectId) Hex() string {
+	return hex.EncodeToString(id[:])
+}
+
+// String returns id in the form ObjectId("5a934e000102030405000000").
+func (id ObjectId) String() string {
+	return `ObjectId("` + id.Hex() + `")`
+}
+
+// IsZero reports whether id is the zero ObjectId.
+func (id ObjectId) IsZero() bool {
+	return id == ObjectId{}
+}
+
+// Timestamp returns the creation time encoded in id, in UTC.
+func (id ObjectId) Timestamp() time.Time {
+	return time.Unix(int64(binary.BigEndian.Uint32(id[:4])), 0).UTC()
+}
+
+// MarshalText implements encoding.TextMarshaler, encoding id as its
+// hexadecimal representation. encoding/json uses it to encode ObjectIds
+// as JSON strings.
+func (id ObjectId) MarshalText() ([]byte, error) {
+	return []byte(id.Hex()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting the
+// hexadecimal representation of an ObjectId. Empty text decodes as the
+// zero ObjectId.
+func (id *ObjectId) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*id = ObjectId{}
+		return nil
+	}
+	v, err := ObjectIdHex(string(text))
+	if err != nil {
+		return err
+	}
+	*id = v
+	return nil
+}
@@ -0,0 +1,152 @@
+package bson
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewObjectId(t *testing.T) {
+	before := time.Now().Truncate(time.Second)
+	a, b := NewObjectId(), NewObjectId()
+	after := time.Now()
+	if a == b {
+		t.Fatalf("NewObjectId: returned %v twice", a)
+	}
+	if ts := a.Timestamp(); ts.Before(before) || ts.After(after) {
+		t.Errorf("Timestamp: %v not between %v and %v", ts, before, after)
+	}
+	if string(a[4:9]) != string(b[4:9]) {
+		t.Errorf("NewObjectId: process bytes differ: %x, %x", a[4:9], b[4:9])
+	}
+	if n := func(id ObjectId) int { return int(id[9])<<16 | int(id[10])<<8 | int(id[11]) }; (n(a)+1)&0xffffff != n(b) {
+		t.Errorf("NewObjectId: counter not incremented: %v, %v", a, b)
+	}
+	if a.IsZero() || !(ObjectId{}).IsZero() {
+		t.Errorf("IsZero: wrong result")
+	}
+}
+
+func TestNewObjectIdConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[ObjectId]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				id := NewObjectId()
+				mu.Lock()
+				if seen[id] {
+					t.Errorf("NewObjectId: duplicate %v", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestObjectIdHex(t *testing.T) {
+	const s = "5a934e000102030405000000"
+	id, err := ObjectIdHex(s)
+	if err != nil {
+		t.Fatalf("ObjectIdHex: %v", err)
+	}
+	if id.Hex() != s {
+		t.Errorf("Hex: expected %q, got %q", s, id.Hex())
+	}
+	if want := `ObjectId("5a934e000102030405000000")`; id.String() != want {
+		t.Errorf("String: expected %q, got %q", want, id.String())
+	}
+	if want := time.Date(2018, 2, 26, 0, 0, 0, 0, time.UTC); !id.Timestamp().Equal(want) {
+		t.Errorf("Timestamp: expected %v, got %v", want, id.Timestamp())
+	}
+	for _, bad := range []string{"", "5a934e00010203040500000", "5a934e000102030405000000ff", "5a934e00010203040500000g"} {
+		if _, err := ObjectIdHex(bad); err == nil {
+			t.Errorf("ObjectIdHex(%q): expected error", bad)
+		}
+	}
+}
+
+func TestObjectIdJSON(t *testing.T) {
+	type doc struct {
+		ID  ObjectId
+		Ref *ObjectId `json:",omitempty"`
+	}
+	id, _ := ObjectIdHex("5a934e000102030405000000")
+	b, err := json.Marshal(doc{ID: id})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if want := `{"ID":"5a934e000102030405000000"}`; string(b) != want {
+		t.Errorf("json.Marshal: expected %s, got %s", want, b)
+	}
+	var got doc
+	if err := json.Unmarshal([]byte(`{"ID":"5a934e000102030405000000","Ref":"000000000000000000000000"}`), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if got.ID != id || got.Ref == nil || !got.Ref.IsZero() {
+		t.Errorf("json.Unmarshal: got %v, %v", got.ID, got.Ref)
+	}
+	if err := json.Unmarshal([]byte(`{"ID":"nothex"}`), &got); err == nil {
+		t.Errorf("json.Unmarshal: expected error for invalid hex")
+	}
+}
+
+func TestObjectIdFromTime(t *testing.T) {
+	t0 := time.Date(2018, 2, 26, 0, 0, 0, 500e6, time.UTC)
+	lo, hi := ObjectIdFromTime(t0), MaxObjectIdFromTime(t0)
+	if want := "5a934e000000000000000000"; lo.Hex() != want {
+		t.Errorf("ObjectIdFromTime: expected %s, got %s", want, lo.Hex())
+	}
+	if want := "5a934e00ffffffffffffffff"; hi.Hex() != want {
+		t.Errorf("MaxObjectIdFromTime: expected %s, got %s", want, hi.Hex())
+	}
+	id, _ := ObjectIdHex("5a934e000102030405000000")
+	if !lo.Before(id) || !hi.After(id) || lo.Compare(id) != -1 || hi.Compare(id) != 1 || id.Compare(id) != 0 {
+		t.Errorf("Compare: %v should lie between %v and %v", id, lo, hi)
+	}
+	next := ObjectIdFromTime(t0.Add(time.Second))
+	if !hi.Before(next) {
+		t.Errorf("Compare: %v should order before %v", hi, next)
+	}
+
+	if got := ObjectIdFromTime(time.Unix(-1, 0)); !got.IsZero() {
+		t.Errorf("ObjectIdFromTime: expected zero ObjectId before 1970, got %v", got)
+	}
+	if got := ObjectIdFromTime(time.Unix(1<<32, 0)); got.Hex() != "ffffffff0000000000000000" {
+		t.Errorf("ObjectIdFromTime: expected clamped ObjectId after 2106, got %v", got)
+	}
+}
+
+func TestObjectIdWindow(t *testing.T) {
+	// filter documents by the creation time of their _id without
+	// decoding them.
+	start := time.Date(2018, 2, 26, 0, 0, 0, 0, time.UTC)
+	var docs []Raw
+	for i := 0; i < 5; i++ {
+		id := newObjectId(start.Add(time.Duration(i)*time.Hour), uint32(i))
+		b, err := Marshal(D{{"_id", id}, {"n", i}})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		docs = append(docs, b)
+	}
+	lo := ObjectIdFromTime(start.Add(time.Hour))
+	hi := MaxObjectIdFromTime(start.Add(3 * time.Hour))
+	var got []int32
+	for _, doc := range docs {
+		id, ok := doc.Lookup("_id").ObjectIDOK()
+		if !ok || id.Before(lo) || id.After(hi) {
+			continue
+		}
+		got = append(got, doc.Lookup("n").Int32())
+	}
+	if len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Errorf("expected documents 1 to 3, got %v", got)
+	}
+}
@@ -0,0 +1,117 @@
+package bson
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Raw is an encoded BSON document. Its elements are read on demand, so
+// fields of a large document can be looked up without decoding the rest.
+//
+// Unmarshal stores embedded documents and arrays in Raw values without
+// copying them, and Marshal writes a Raw unchanged, or as null if it is
+// nil.
+type Raw []byte
+
+// RawValue is the encoded value of a single BSON element of type Type.
+// Value holds the element's value as it appears in a document, including
+// any length prefix. Marshal returns an error for a RawValue which does
+// not hold exactly one well formed value, such as the zero RawValue.
+type RawValue struct {
+	Type  byte
+	Value []byte
+}
+
+// RawElement is a single element of a Raw document.
+type RawElement struct {
+	Key   string
+	Value RawValue
+}
+
+// ErrElementNotFound is returned by Raw.LookupErr when no element matches
+// the path.
+var ErrElementNotFound = errors.New("bson: element not found")
+
+var (
+	rawType      = reflect.TypeOf(Raw(nil))
+	rawValueType = reflect.TypeOf(RawValue{})
+)
+
+// Validate checks that r and any documents embedded in it are well
+// formed, as described by the package function Validate.
+func (r Raw) Validate() error {
+	return Validate(r)
+}
+
+// Elements returns the elements of r, in order.
+func (r Raw) Elements() ([]RawElement, error) {
+	if err := checkDocument(r); err != nil {
+		return nil, err
+	}
+	var elems []RawElement
+	iter := newReader(r)
+	for iter.Next() {
+		typ, ename, _ := iter.Element()
+		elems = append(elems, RawElement{
+			Key:   string(trimlast(ename)),
+			Value: RawValue{Type: typ, Value: iter.Value()},
+		})
+	}
+	return elems, iter.Err()
+}
+
+// Lookup returns the value of the element found by following path
+// through r and its embedded documents and arrays. Array elements are
+// named by their index, "0", "1" and so on. If no element matches, or r is
+// corrupt, the zero RawValue is returned.
+func (r Raw) Lookup(path ...string) RawValue {
+	v, _ := r.LookupErr(path...)
+	return v
+}
+
+// LookupErr is like Lookup but returns ErrElementNotFound if no element
+// matches path, or the error encountered reading a corrupt document.
+func (r Raw) LookupErr(path ...string) (RawValue, error) {
+	if len(path) == 0 {
+		return RawValue{}, ErrElementNotFound
+	}
+	if len(r) < 5 {
+		return RawValue{}, ErrTooShort
+	}
+	iter := newReader(r)
+	for iter.Next() {
+		typ, ename, element := iter.Element()
+		if string(trimlast(ename)) != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return RawValue{Type: typ, Value: iter.Value()}, nil
+		}
+		if typ != 0x03 && typ != 0x04 {
+			return RawValue{}, ErrElementNotFound
+		}
+		v, err := Raw(element).LookupErr(path[1:]...)
+		return v, iter.annotate(err)
+	}
+	if err := iter.Err(); err != nil {
+		return RawValue{}, err
+	}
+	return RawValue{}, ErrElementNotFound
+}
+
+// decodeRaw stores value, the encoded value of a BSON element of type typ,
+// in v if v is a Raw or RawValue. It reports whether v was set.
+func decodeRaw(v reflect.Value, typ byte, value []byte) bool {
+	switch v.Type() {
+	case rawType:
+		if typ != 0x03 && typ != 0x04 {
+			return false
+		}
+		v.SetBytes(value)
+	case rawValueType:
+		v.Set(reflect.ValueOf(RawValue{Type: typ, Value: value}))
+	default:
+		return false
+	}
+	return true
+}
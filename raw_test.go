@@ -0,0 +1,117 @@
+package bson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func rawTestDoc(t *testing.T) []byte {
+	data, err := Marshal(D{
+		{"name", "dave"},
+		{"sub", D{{"n", int32(7)}, {"tags", []interface{}{"a", "b"}}}},
+	})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return data
+}
+
+func TestRawLookup(t *testing.T) {
+	r := Raw(rawTestDoc(t))
+	tests := []struct {
+		path []string
+		want RawValue
+	}{
+		{[]string{"name"}, RawValue{0x02, []byte("\x05\x00\x00\x00dave\x00")}},
+		{[]string{"sub", "n"}, RawValue{0x10, []byte("\x07\x00\x00\x00")}},
+		{[]string{"sub", "tags", "1"}, RawValue{0x02, []byte("\x02\x00\x00\x00b\x00")}},
+		{[]string{"sub", "missing"}, RawValue{}},
+		{[]string{"name", "deeper"}, RawValue{}},
+		{nil, RawValue{}},
+	}
+	for _, tt := range tests {
+		if got := r.Lookup(tt.path...); !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("Lookup(%q): expected %v, got %v", tt.path, tt.want, got)
+		}
+	}
+	if _, err := r.LookupErr("nope"); err != ErrElementNotFound {
+		t.Errorf("LookupErr: expected ErrElementNotFound, got %v", err)
+	}
+}
+
+func TestRawElements(t *testing.T) {
+	elems, err := Raw(rawTestDoc(t)).Elements()
+	if err != nil {
+		t.Fatalf("Elements: %v", err)
+	}
+	if len(elems) != 2 || elems[0].Key != "name" || elems[1].Key != "sub" || elems[1].Value.Type != 0x03 {
+		t.Errorf("Elements: got %v", elems)
+	}
+}
+
+func TestRawValidate(t *testing.T) {
+	data := rawTestDoc(t)
+	if err := Raw(data).Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	bad := append([]byte(nil), data...)
+	bad[len(bad)-1] = 1
+	if err := Raw(bad).Validate(); err == nil {
+		t.Errorf("Validate: expected error for missing trailer")
+	}
+	bad = append([]byte(nil), data...)
+	bad[len(bad)-2] = 1 // trailer of sub
+	if err := Raw(bad).Validate(); err == nil {
+		t.Errorf("Validate: expected error for corrupt embedded document")
+	}
+}
+
+func TestUnmarshalRaw(t *testing.T) {
+	data := rawTestDoc(t)
+	var v struct {
+		Name RawValue `bson:"name"`
+		Sub  Raw      `bson:"sub"`
+	}
+	if err := Unmarshal(data, &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if v.Name.Type != 0x02 {
+		t.Errorf("Unmarshal: expected string RawValue, got %v", v.Name)
+	}
+	if &v.Sub[0] != &data[len(data)-len(v.Sub)-1] {
+		t.Errorf("Unmarshal: Raw field was copied")
+	}
+	// and back again
+	out, err := Marshal(&v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !reflect.DeepEqual(data, out) {
+		t.Errorf("Marshal: expected %q, got %q", data, out)
+	}
+}
+
+func TestMarshalRaw(t *testing.T) {
+	r := Raw(rawTestDoc(t))
+	for _, v := range []RawValue{
+		r.Lookup("missing"),
+		{Type: 0x10, Value: []byte{1}},
+		{Type: 0x10, Value: []byte{1, 0, 0, 0, 0}},
+		{Type: 0x02, Value: []byte("\x05\x00\x00\x00x\x00")},
+		{Type: 0x03, Value: []byte("\x05\x00\x00\x00\x01")},
+	} {
+		if b, err := Marshal(D{{"x", v}, {"y", int32(1)}}); err == nil {
+			t.Errorf("Marshal(%v): expected error, got %q", v, b)
+		}
+	}
+
+	// a nil Raw is written as null
+	var v struct{ Sub Raw }
+	b, err := Marshal(v)
+	if want := "\x0a\x00\x00\x00\x0aSub\x00\x00"; err != nil || string(b) != want {
+		t.Errorf("Marshal(%+v): expected %q, got %q, %v", v, want, b, err)
+	}
+	if err := Unmarshal(b, &v); err != nil || v.Sub != nil {
+		t.Errorf("Unmarshal(%q): expected nil Raw, got %q, %v", b, v.Sub, err)
+	}
+}
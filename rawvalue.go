@@ -0,0 +1,181 @@
+package bson
+
+import "math"
+
+// The accessors below return the value of v as a particular Go type. They
+// panic if v is not of the matching BSON type or its value is malformed;
+// the OK variants instead report whether the conversion succeeded.
+
+// Double returns the value of a BSON double.
+func (v RawValue) Double() float64 {
+	f, ok := v.DoubleOK()
+	if !ok {
+		v.panicType(0x01)
+	}
+	return f
+}
+
+// DoubleOK is like Double but reports false rather than panicking.
+func (v RawValue) DoubleOK() (float64, bool) {
+	if v.Type != 0x01 || len(v.Value) != 8 {
+		return 0, false
+	}
+	return math.Float64frombits(uint64(readInt64(v.Value))), true
+}
+
+// StringValue returns the value of a BSON string.
+func (v RawValue) StringValue() string {
+	s, ok := v.StringValueOK()
+	if !ok {
+		v.panicType(0x02)
+	}
+	return s
+}
+
+// StringValueOK is like StringValue but reports false rather than panicking.
+func (v RawValue) StringValueOK() (string, bool) {
+	if v.Type != 0x02 || len(v.Value) < 5 {
+		return "", false
+	}
+	n, rest := readInt32(v.Value)
+	if n != len(rest) || rest[n-1] != 0 {
+		return "", false
+	}
+	return string(trimlast(rest)), true
+}
+
+// Document returns the value of an embedded BSON document.
+func (v RawValue) Document() Raw {
+	d, ok := v.DocumentOK()
+	if !ok {
+		v.panicType(0x03)
+	}
+	return d
+}
+
+// DocumentOK is like Document but reports false rather than panicking.
+func (v RawValue) DocumentOK() (Raw, bool) {
+	if v.Type != 0x03 || checkDocument(v.Value) != nil {
+		return nil, false
+	}
+	return Raw(v.Value), true
+}
+
+// Array returns the value of a BSON array, which is encoded as a document
+// whose keys are the indices of its elements.
+func (v RawValue) Array() Raw {
+	a, ok := v.ArrayOK()
+	if !ok {
+		v.panicType(0x04)
+	}
+	return a
+}
+
+// ArrayOK is like Array but reports false rather than panicking.
+func (v RawValue) ArrayOK() (Raw, bool) {
+	if v.Type != 0x04 || checkDocument(v.Value) != nil {
+		return nil, false
+	}
+	return Raw(v.Value), true
+}
+
+// ObjectID returns the value of a BSON ObjectId.
+func (v RawValue) ObjectID() ObjectId {
+	oid, ok := v.ObjectIDOK()
+	if !ok {
+		v.panicType(0x07)
+	}
+	return oid
+}
+
+// ObjectIDOK is like ObjectID but reports false rather than panicking.
+func (v RawValue) ObjectIDOK() (ObjectId, bool) {
+	var oid ObjectId
+	if v.Type != 0x07 || len(v.Value) != len(oid) {
+		return oid, false
+	}
+	copy(oid[:], v.Value)
+	return oid, true
+}
+
+// Boolean returns the value of a BSON boolean.
+func (v RawValue) Boolean() bool {
+	b, ok := v.BooleanOK()
+	if !ok {
+		v.panicType(0x08)
+	}
+	return b
+}
+
+// BooleanOK is like Boolean but reports false rather than panicking.
+func (v RawValue) BooleanOK() (bool, bool) {
+	if v.Type != 0x08 || len(v.Value) != 1 {
+		return false, false
+	}
+	return v.Value[0] == 1, true
+}
+
+// Datetime returns the value of a BSON UTC datetime.
+func (v RawValue) Datetime() Datetime {
+	dt, ok := v.DatetimeOK()
+	if !ok {
+		v.panicType(0x09)
+	}
+	return dt
+}
+
+// DatetimeOK is like Datetime but reports false rather than panicking.
+func (v RawValue) DatetimeOK() (Datetime, bool) {
+	if v.Type != 0x09 || len(v.Value) != 8 {
+		return 0, false
+	}
+	return Datetime(readInt64(v.Value)), true
+}
+
+// Int32 returns the value of a BSON int32.
+func (v RawValue) Int32() int32 {
+	i, ok := v.Int32OK()
+	if !ok {
+		v.panicType(0x10)
+	}
+	return i
+}
+
+// Int32OK is like Int32 but reports false rather than panicking.
+func (v RawValue) Int32OK() (int32, bool) {
+	if v.Type != 0x10 || len(v.Value) != 4 {
+		return 0, false
+	}
+	n, _ := readInt32(v.Value)
+	return int32(n), true
+}
+
+// Int64 returns the value of a BSON int64.
+func (v RawValue) Int64() int64 {
+	i, ok := v.Int64OK()
+	if !ok {
+		v.panicType(0x12)
+	}
+	return i
+}
+
+// Int64OK is like Int64 but reports false rather than panicking.
+func (v RawValue) Int64OK() (int64, bool) {
+	if v.Type != 0x12 || len(v.Value) != 8 {
+		return 0, false
+	}
+	return readInt64(v.Value), true
+}
+
+// TypeName returns the name of v's BSON type, such as "int32" or
+// "objectId".
+func (v RawValue) TypeName() string {
+	return typeName(v.Type)
+}
+
+func (v RawValue) panicType(want byte) {
+	if v.Type == want {
+		panic("bson: malformed " + typeName(want) + " RawValue")
+	}
+	panic("bson: RawValue is " + typeName(v.Type) + ", not " + typeName(want))
+}
@@ -0,0 +1,77 @@
+package bson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRawValueAccessors(t *testing.T) {
+	oid := ObjectId{0xde, 0xad, 0xbe, 0xef}
+	data, err := Marshal(D{
+		{"d", 1.5},
+		{"s", "str"},
+		{"doc", D{{"k", true}}},
+		{"arr", []interface{}{int32(1)}},
+		{"oid", oid},
+		{"b", true},
+		{"dt", Datetime(1234)},
+		{"i32", int32(-2)},
+		{"i64", int64(1 << 40)},
+	})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	r := Raw(data)
+	if got := r.Lookup("d").Double(); got != 1.5 {
+		t.Errorf("Double: got %v", got)
+	}
+	if got := r.Lookup("s").StringValue(); got != "str" {
+		t.Errorf("StringValue: got %v", got)
+	}
+	if got := r.Lookup("doc").Document().Lookup("k").Boolean(); !got {
+		t.Errorf("Document: got %v", got)
+	}
+	if got := r.Lookup("arr").Array().Lookup("0").Int32(); got != 1 {
+		t.Errorf("Array: got %v", got)
+	}
+	if got := r.Lookup("oid").ObjectID(); got != oid {
+		t.Errorf("ObjectID: got %v", got)
+	}
+	if got := r.Lookup("b").Boolean(); !got {
+		t.Errorf("Boolean: got %v", got)
+	}
+	if got := r.Lookup("dt").Datetime(); got != 1234 {
+		t.Errorf("Datetime: got %v", got)
+	}
+	if got := r.Lookup("i32").Int32(); got != -2 {
+		t.Errorf("Int32: got %v", got)
+	}
+	if got := r.Lookup("i64").Int64(); got != 1<<40 {
+		t.Errorf("Int64: got %v", got)
+	}
+}
+
+func TestRawValueOK(t *testing.T) {
+	v := RawValue{Type: 0x10, Value: []byte{1, 0, 0, 0}}
+	if _, ok := v.Int64OK(); ok {
+		t.Errorf("Int64OK: expected false for int32")
+	}
+	if _, ok := v.StringValueOK(); ok {
+		t.Errorf("StringValueOK: expected false for int32")
+	}
+	if _, ok := (RawValue{Type: 0x02, Value: []byte("\x09\x00\x00\x00abc\x00")}).StringValueOK(); ok {
+		t.Errorf("StringValueOK: expected false for bad length")
+	}
+	if _, ok := (RawValue{}).DocumentOK(); ok {
+		t.Errorf("DocumentOK: expected false for zero RawValue")
+	}
+	if name := v.TypeName(); name != "int32" {
+		t.Errorf("TypeName: expected int32, got %s", name)
+	}
+	defer func() {
+		if r := recover(); !reflect.DeepEqual(r, "bson: RawValue is int32, not double") {
+			t.Errorf("Double: expected panic, got %v", r)
+		}
+	}()
+	v.Double()
+}
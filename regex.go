@@ -0,0 +1,79 @@
+package bson
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Regex represents a BSON regular expression. Pattern is not interpreted
+// and Options holds the option flags, which are written in alphabetical
+// order when r is encoded.
+type Regex struct {
+	Pattern string
+	Options string
+}
+
+// NewRegex returns a Regex for pattern, validating and sorting options.
+// The valid options are
+//
+//	i  case insensitive matching
+//	l  locale dependent \w, \W, etc.
+//	m  multiline matching
+//	s  dotall mode, '.' matches everything
+//	u  unicode aware \w, \W, etc.
+//	x  verbose mode
+func NewRegex(pattern, options string) (Regex, error) {
+	if strings.IndexByte(pattern, 0) >= 0 {
+		return Regex{}, errors.New("bson: regex pattern contains \\0")
+	}
+	opts, err := sortRegexOptions(options)
+	if err != nil {
+		return Regex{}, err
+	}
+	return Regex{Pattern: pattern, Options: opts}, nil
+}
+
+// sortRegexOptions returns options in alphabetical order, or an error if
+// options contains an unknown or repeated flag.
+func sortRegexOptions(options string) (string, error) {
+	b := []byte(options)
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	for i, c := range b {
+		if strings.IndexByte("ilmsux", c) < 0 {
+			return "", errors.New("bson: unknown regex option " + string(rune(c)))
+		}
+		if i > 0 && b[i-1] == c {
+			return "", errors.New("bson: repeated regex option " + string(rune(c)))
+		}
+	}
+	return string(b), nil
+}
+
+// String returns r in the form /pattern/options.
+func (r Regex) String() string {
+	return "/" + r.Pattern + "/" + r.Options
+}
+
+// Regexp compiles r into a Go regular expression. The i, m and s options
+// map onto the corresponding RE2 flags and u is implied, but the l and x
+// options have no RE2 equivalent and return an error, as will patterns
+// using PCRE syntax that RE2 does not support.
+func (r Regex) Regexp() (*regexp.Regexp, error) {
+	var flags string
+	for _, c := range r.Options {
+		switch c {
+		case 'i', 'm', 's':
+			flags += string(c)
+		case 'u':
+			// RE2 is always unicode aware
+		default:
+			return nil, errors.New("bson: regex option " + string(c) + " cannot be translated")
+		}
+	}
+	if flags == "" {
+		return regexp.Compile(r.Pattern)
+	}
+	return regexp.Compile("(?" + flags + ")" + r.Pattern)
+}
@@ -0,0 +1,68 @@
+package bson
+
+import (
+	"reflect"
+	"testing"
+)
+
+var newRegexTests = []struct {
+	pattern, options string
+	want             Regex
+	err              bool
+}{
+	{pattern: "^abc", options: "", want: Regex{"^abc", ""}},
+	{pattern: "^abc", options: "xsmi", want: Regex{"^abc", "imsx"}},
+	{pattern: "^abc", options: "ig", err: true},
+	{pattern: "^abc", options: "ii", err: true},
+	{pattern: "a\x00b", options: "i", err: true},
+}
+
+func TestNewRegex(t *testing.T) {
+	for _, tt := range newRegexTests {
+		got, err := NewRegex(tt.pattern, tt.options)
+		if (err != nil) != tt.err {
+			t.Errorf("NewRegex(%q, %q): unexpected error %v", tt.pattern, tt.options, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NewRegex(%q, %q): expected %v, got %v", tt.pattern, tt.options, tt.want, got)
+		}
+	}
+}
+
+func TestRegexRegexp(t *testing.T) {
+	re, err := Regex{Pattern: "^ab.c$", Options: "imsu"}.Regexp()
+	if err != nil {
+		t.Fatalf("Regexp: %v", err)
+	}
+	if !re.MatchString("xx\nAB\nC") {
+		t.Errorf("Regexp: %v did not match", re)
+	}
+	if _, err := (Regex{Pattern: "a b", Options: "x"}).Regexp(); err == nil {
+		t.Errorf("Regexp: expected error for option x")
+	}
+}
+
+func TestRegexRoundTrip(t *testing.T) {
+	data, err := Marshal(M{"re": Regex{Pattern: "^a", Options: "mi"}})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := []byte("\x0f\x00\x00\x00\x0bre\x00^a\x00im\x00\x00")
+	if !reflect.DeepEqual(want, data) {
+		t.Errorf("Marshal: expected %q, got %q", want, data)
+	}
+	var v struct{ Re Regex }
+	if err := Unmarshal(data, &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if v.Re != (Regex{Pattern: "^a", Options: "im"}) {
+		t.Errorf("Unmarshal: got %v", v.Re)
+	}
+	// empty options
+	data, _ = Marshal(M{"re": Regex{Pattern: "a"}})
+	m := make(map[string]interface{})
+	if err := Unmarshal(data, &m); err != nil || m["re"] != (Regex{Pattern: "a"}) {
+		t.Errorf("Unmarshal: got %v %v", m, err)
+	}
+}
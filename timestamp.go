@@ -0,0 +1,79 @@
+package bson
+
+import (
+	"sync"
+	"time"
+)
+
+// Timestamp represents a BSON timestamp, used internally by MongoDB for
+// replication. The high 32 bits, T, are seconds since the Unix epoch and
+// the low 32 bits, I, an increment distinguishing timestamps within the
+// same second. Timestamps order by T and then by I.
+type Timestamp uint64
+
+// NewTimestamp returns the Timestamp with components t and i.
+func NewTimestamp(t, i uint32) Timestamp {
+	return Timestamp(uint64(t)<<32 | uint64(i))
+}
+
+// T returns the seconds component of ts.
+func (ts Timestamp) T() uint32 { return uint32(ts >> 32) }
+
+// I returns the increment component of ts.
+func (ts Timestamp) I() uint32 { return uint32(ts) }
+
+// Time returns the seconds component of ts as a time.Time in UTC.
+func (ts Timestamp) Time() time.Time {
+	return time.Unix(int64(ts.T()), 0).UTC()
+}
+
+// Compare returns -1, 0 or +1 depending on whether ts orders before, the
+// same as, or after u.
+func (ts Timestamp) Compare(u Timestamp) int {
+	switch {
+	case ts < u:
+		return -1
+	case ts > u:
+		return 1
+	}
+	return 0
+}
+
+// Before reports whether ts orders before u.
+func (ts Timestamp) Before(u Timestamp) bool { return ts < u }
+
+// After reports whether ts orders after u.
+func (ts Timestamp) After(u Timestamp) bool { return ts > u }
+
+// A TimestampGenerator produces unique, strictly increasing Timestamps
+// based on the current time. Timestamps generated within the same second
+// share T and have increasing I; if the clock goes backwards T is held
+// until it catches up. The zero value is ready to use, and a
+// TimestampGenerator is safe for concurrent use.
+type TimestampGenerator struct {
+	mu   sync.Mutex
+	last Timestamp
+	now  func() time.Time // for testing
+}
+
+// Next returns the next Timestamp.
+func (g *TimestampGenerator) Next() Timestamp {
+	now := time.Now
+	if g.now != nil {
+		now = g.now
+	}
+	t := uint32(now().Unix())
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case t > g.last.T():
+		g.last = NewTimestamp(t, 1)
+	case g.last.I() == 1<<32-1:
+		// increment exhausted, borrow the next second
+		g.last = NewTimestamp(g.last.T()+1, 1)
+	default:
+		g.last++
+	}
+	return g.last
+}
@@ -0,0 +1,84 @@
+package bson
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTimestamp(t *testing.T) {
+	ts := NewTimestamp(1479724200, 7)
+	if ts.T() != 1479724200 || ts.I() != 7 {
+		t.Errorf("NewTimestamp: got T %d I %d", ts.T(), ts.I())
+	}
+	if want := time.Date(2016, 11, 21, 10, 30, 0, 0, time.UTC); !ts.Time().Equal(want) {
+		t.Errorf("Time: expected %v, got %v", want, ts.Time())
+	}
+	later := []Timestamp{NewTimestamp(1479724200, 8), NewTimestamp(1479724201, 0)}
+	for _, u := range later {
+		if !ts.Before(u) || ts.After(u) || ts.Compare(u) != -1 || u.Compare(ts) != 1 {
+			t.Errorf("%v should order before %v", ts, u)
+		}
+	}
+	if ts.Compare(ts) != 0 {
+		t.Errorf("Compare: expected 0 comparing %v with itself", ts)
+	}
+
+	// test35.bson
+	data := []byte("\x18\x00\x00\x00\x11timestamp\x00\x94\x26\x00\x00\xd2\x04\x00\x00\x00")
+	var v struct{ Timestamp Timestamp }
+	if err := Unmarshal(data, &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if v.Timestamp.T() != 1234 || v.Timestamp.I() != 9876 {
+		t.Errorf("Unmarshal: got T %d I %d", v.Timestamp.T(), v.Timestamp.I())
+	}
+}
+
+func TestTimestampGenerator(t *testing.T) {
+	clock := []int64{100, 100, 99, 101}
+	g := TimestampGenerator{now: func() time.Time {
+		now := clock[0]
+		clock = clock[1:]
+		return time.Unix(now, 0)
+	}}
+	want := []Timestamp{
+		NewTimestamp(100, 1),
+		NewTimestamp(100, 2),
+		NewTimestamp(100, 3), // clock went backwards
+		NewTimestamp(101, 1),
+	}
+	for _, w := range want {
+		if got := g.Next(); got != w {
+			t.Errorf("Next: expected %d/%d, got %d/%d", w.T(), w.I(), got.T(), got.I())
+		}
+	}
+
+	g = TimestampGenerator{last: NewTimestamp(100, 1<<32-1), now: func() time.Time { return time.Unix(100, 0) }}
+	if got := g.Next(); got != NewTimestamp(101, 1) {
+		t.Errorf("Next: expected 101/1 after exhausting increment, got %d/%d", got.T(), got.I())
+	}
+}
+
+func TestTimestampGeneratorConcurrent(t *testing.T) {
+	var g TimestampGenerator
+	var mu sync.Mutex
+	seen := make(map[Timestamp]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				ts := g.Next()
+				mu.Lock()
+				if seen[ts] {
+					t.Errorf("Next: duplicate timestamp %d/%d", ts.T(), ts.I())
+				}
+				seen[ts] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,116 @@
+package bson
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// MaxDepth is the deepest nesting of embedded documents and arrays that
+// Unmarshal, Validate and the JSON renderers accept. Deeper documents are
+// reported as a *SyntaxError rather than exhausting the stack. Marshal
+// likewise returns an *UnsupportedValueError for deeper values, which
+// includes those containing cycles.
+const MaxDepth = 1000
+
+// Validate checks that data is a single BSON document conforming strictly
+// to the specification. As well as the checks made while decoding, it
+// verifies that
+//   - the declared length of each document, including the outermost,
+//     matches its contents and each ends in 0x00,
+//   - element names and strings are NUL-terminated and valid UTF-8,
+//   - booleans are 0x00 or 0x01, and
+//   - code with scope elements hold a valid scope document, and
+//   - documents are nested no more than MaxDepth deep.
+//
+// The error returned for corrupt data is an *InvalidBSONTypeError or a
+// *SyntaxError giving the offset and path of the offending element.
+func Validate(data []byte) error {
+	return validateDocument(data, true, 0)
+}
+
+// validateDocument walks the BSON document data and every document
+// embedded in it, returning the first error found. Unless strict is set it
+// checks only that the lengths and terminators are consistent, which is
+// all the renderers need to walk data safely. depth is the nesting of data
+// within the outermost document.
+func validateDocument(data []byte, strict bool, depth int) error {
+	if depth > MaxDepth {
+		return errMaxDepth()
+	}
+	if len(data) < 5 {
+		return ErrTooShort
+	}
+	if n, _ := readInt32(data); n != len(data) {
+		return &SyntaxError{msg: "document length does not match header", Offset: 0}
+	}
+	if data[len(data)-1] != 0 {
+		return &SyntaxError{msg: "document missing trailing 0x00", Offset: int64(len(data) - 1)}
+	}
+	iter := newReader(data)
+	for iter.Next() {
+		typ, ename, element := iter.Element()
+		if strict && !utf8.Valid(ename) {
+			return &SyntaxError{msg: "invalid UTF-8 in element name", Offset: int64(iter.voff - len(ename))}
+		}
+		if err := validateElement(typ, element, strict, depth+1); err != nil {
+			return iter.annotate(err)
+		}
+	}
+	return iter.Err()
+}
+
+// validateElement checks the parts of a BSON element of type typ not
+// already checked by reader.Next, recursing into embedded documents. The
+// offsets of errors are relative to the start of the element's value.
+func validateElement(typ byte, element []byte, strict bool, depth int) error {
+	switch typ {
+	case 0x03, 0x04:
+		return validateDocument(element, strict, depth)
+	case 0x0f:
+		n, _ := readInt32(element[sizeofInt32:])
+		if strict {
+			if err := validateString(element[2*sizeofInt32:2*sizeofInt32+n], 2*sizeofInt32); err != nil {
+				return err
+			}
+		}
+		err := validateDocument(element[2*sizeofInt32+n:], strict, depth)
+		if e, ok := err.(*SyntaxError); ok {
+			e.Offset += int64(2*sizeofInt32 + n)
+		}
+		return err
+	}
+	if !strict {
+		return nil
+	}
+	switch typ {
+	case 0x02, 0x0d, 0x0e:
+		// string, JavaScript code and symbol
+		return validateString(element, sizeofInt32)
+	case 0x08:
+		if element[0] > 1 {
+			return &SyntaxError{msg: "invalid boolean", Offset: 0}
+		}
+	case 0x0b:
+		// regex, the reader has found both NULs
+		i := bytes.IndexByte(element, 0)
+		if !utf8.Valid(element[:i]) || !utf8.Valid(element[i+1:]) {
+			return &SyntaxError{msg: "invalid UTF-8 in regex", Offset: 0}
+		}
+	case 0x0c:
+		n, _ := readInt32(element)
+		return validateString(element[sizeofInt32:sizeofInt32+n], sizeofInt32)
+	}
+	return nil
+}
+
+// validateString checks that the string s, whose bytes start off bytes
+// into the element's value, is NUL-terminated valid UTF-8.
+func validateString(s []byte, off int) error {
+	if s[len(s)-1] != 0 {
+		return &SyntaxError{msg: "string not NUL-terminated", Offset: int64(off + len(s) - 1)}
+	}
+	if !utf8.Valid(s) {
+		return &SyntaxError{msg: "invalid UTF-8 in string", Offset: int64(off)}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package bson
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		data string
+		err  error
+	}{
+		{"\x05\x00\x00\x00\x00", nil},
+		{"\x12\x00\x00\x00\x02a\x00\x02\x00\x00\x00\xc3\x00\x08b\x00\x01\x00", &SyntaxError{msg: "invalid UTF-8 in string", Offset: 11, Path: "a"}},
+		{"\x09\x00\x00\x00\x08b\x00\x02\x00", &SyntaxError{msg: "invalid boolean", Offset: 7, Path: "b"}},
+		{"\x09\x00\x00\x00\x08\xff\x00\x01\x00", &SyntaxError{msg: "invalid UTF-8 in element name", Offset: 5}},
+		{"\x07\x00\x00\x00\x00\x00", &SyntaxError{msg: "document length does not match header"}},
+		{"\x0d\x00\x00\x00\x03d\x00\x05\x00\x00\x00\x01\x00", &SyntaxError{msg: "document missing trailing 0x00", Offset: 11, Path: "d"}},
+		{"\x0c\x00\x00\x00\x0br\x00\xff\x00i\x00\x00", &SyntaxError{msg: "invalid UTF-8 in regex", Offset: 7, Path: "r"}},
+		{"\x1a\x00\x00\x00\x0cp\x00\x02\x00\x00\x00c!\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x00", &SyntaxError{msg: "string not NUL-terminated", Offset: 12, Path: "p"}},
+		{"\x17\x00\x00\x00\x0fc\x00\x0f\x00\x00\x00\x02\x00\x00\x00x\x00\x05\x00\x00\x00\x00\x00", nil},
+		{"\x1a\x00\x00\x00\x0fc\x00\x12\x00\x00\x00\x02\x00\x00\x00x\x00\x08\x00\x00\x00\x08b\x00\x00\x00", &SyntaxError{msg: "corrupt BSON reading boolean", Offset: 21, Path: "c.b"}},
+	}
+	for _, tt := range tests {
+		if err := Validate([]byte(tt.data)); !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("Validate(%q): expected %v, got %v", tt.data, tt.err, err)
+		}
+	}
+}
+
+func TestValidateFiles(t *testing.T) {
+	tests := []struct {
+		f   string
+		err error
+	}{
+		{"test1.bson", nil},
+		{"test24.bson", nil},
+		{"codewscope.bson", nil},
+		{"trailingnull.bson", &SyntaxError{msg: "string not NUL-terminated", Offset: 14, Path: "a"}},
+		{"overflow1.bson", &SyntaxError{msg: "document length does not match header"}},
+		{"overflow2.bson", &SyntaxError{msg: "corrupt document: want f bytes, have e", Offset: 4, Path: "foo"}},
+		{"overflow3.bson", &SyntaxError{msg: "corrupt document: want c bytes, have b", Offset: 4, Path: "foo"}},
+		{"overflow4.bson", &SyntaxError{msg: "corrupt BSON reading utf8 string", Offset: 13, Path: "foo.bar"}},
+	}
+	for _, tt := range tests {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", tt.f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Validate(data); !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("Validate(%s): expected %v, got %v", tt.f, tt.err, err)
+		}
+	}
+}
+
+// nestedDocument returns a document holding n levels of embedded
+// documents, {"a": {"a": ... {}}}.
+func nestedDocument(n int) []byte {
+	b := make([]byte, 0, 8*n+5)
+	for i := 0; i < n; i++ {
+		size := 5 + 8*(n-i)
+		b = append(b, byte(size), byte(size>>8), byte(size>>16), byte(size>>24), 0x03, 'a', 0)
+	}
+	b = append(b, 5, 0, 0, 0, 0)
+	return append(b, make([]byte, n)...)
+}
+
+func TestMaxDepth(t *testing.T) {
+	tests := []struct {
+		depth int
+		ok    bool
+	}{
+		{MaxDepth, true},
+		{MaxDepth + 1, false},
+		{2000000, false}, // deep enough to exhaust the stack without a limit
+	}
+	for _, tt := range tests {
+		data := nestedDocument(tt.depth)
+		check := func(name string, err error) {
+			if _, isSyntax := err.(*SyntaxError); tt.ok && err != nil || !tt.ok && !isSyntax {
+				t.Errorf("%s: depth %d: expected ok %v, got %v", name, tt.depth, tt.ok, err)
+			}
+		}
+		check("Validate", Validate(data))
+		var m map[string]interface{}
+		check("Unmarshal", Unmarshal(data, &m))
+		var d D
+		check("Unmarshal", Unmarshal(data, &d))
+		_, err := MarshalExtJSON(Raw(data), true)
+		check("MarshalExtJSON", err)
+		_, err = MarshalJSON(Raw(data), nil)
+		check("MarshalJSON", err)
+	}
+}